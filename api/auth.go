@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"github.com/labstack/gommon/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ClientContextKey is the key under which the authenticated Client is stored
+// in the echo context.
+const ClientContextKey = "client"
+
+// secretContextKey is the key under which the ID of the secret a client
+// authenticated with is stored, so it can be logged.
+const secretContextKey = "secret"
+
+// clients returns the clients allowed to use the API. The legacy basic auth
+// username is a client with every scope, whose secrets are the basic auth
+// password and, while it is being rotated, the previous password. It is an
+// error for two clients to have the same name, as one would be silently
+// replaced by the other.
+func clients(config Config) ([]Client, error) {
+	clients := append([]Client{}, config.Clients...)
+	if config.BasicAuthUsername != "" {
+		if config.BasicAuthPassword == "" {
+			return nil, fmt.Errorf("a basic auth password is required")
+		}
+		secrets := []Secret{legacySecret("current", config.BasicAuthPassword)}
+		if config.BasicAuthPreviousPassword != "" {
+			secrets = append(secrets, legacySecret("previous", config.BasicAuthPreviousPassword))
+		}
+		clients = append(clients, Client{
+			Name:    config.BasicAuthUsername,
+			Secrets: secrets,
+			Scopes:  AllScopes,
+		})
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("at least one client or a basic auth username is required")
+	}
+
+	names := map[string]bool{}
+	for _, client := range clients {
+		if names[client.Name] {
+			return nil, fmt.Errorf("more than one client is named %s", client.Name)
+		}
+		names[client.Name] = true
+	}
+	return clients, nil
+}
+
+func legacySecret(id string, password string) Secret {
+	// The hash is only kept in memory, so the cost only needs to be high
+	// enough for bcrypt to accept it
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		panic(fmt.Sprintf("invalid basic auth password: %s", err))
+	}
+	return Secret{ID: id, Hash: string(hash)}
+}
+
+// authenticate accepts a bearer token, if a verifier is configured, or else
+// basic auth.
+func authenticate(store *clientStore, verifier *TokenVerifier) echo.MiddlewareFunc {
+	basic := basicAuth(store)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		basicNext := basic(next)
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			if verifier == nil || skipAuth(c) || !strings.HasPrefix(auth, bearer) {
+				return basicNext(c)
+			}
+
+			client, err := verifier.Verify(strings.TrimPrefix(auth, bearer))
+			if err != nil {
+				c.Logger().Infoj(log.JSON{
+					"message":    "invalid-bearer-token",
+					"request_id": requestID(c),
+					"error":      err.Error(),
+				})
+				return echo.ErrUnauthorized
+			}
+			c.Set(ClientContextKey, client)
+			return next(c)
+		}
+	}
+}
+
+const bearer = "Bearer "
+
+// skipAuth lets anyone use the status and health check routes.
+func skipAuth(c echo.Context) bool {
+	switch c.Path() {
+	case "/", "/healthz", "/readyz":
+		return true
+	}
+	return false
+}
+
+func basicAuth(store *clientStore) echo.MiddlewareFunc {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper: skipAuth,
+		Validator: func(requestUsername, requestPassword string, c echo.Context) (bool, error) {
+			client, secretID, ok := store.Authenticate(requestUsername, requestPassword)
+			if !ok {
+				return false, nil
+			}
+			c.Set(ClientContextKey, client)
+			c.Set(secretContextKey, secretID)
+			return true, nil
+		},
+	})
+}
+
+// requireScope rejects requests from clients that have not been granted
+// every one of the scopes.
+func requireScope(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			client, ok := c.Get(ClientContextKey).(Client)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			for _, scope := range scopes {
+				if !client.HasScope(scope) {
+					return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("the %s scope is required", scope))
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireScopeOrSelf is like requireScope, but also lets through a client
+// acting for a single user when the request is for that user. Routes with a
+// :uuid param are checked here. Handlers of routes without one must check
+// the user the request is for with requireSelf.
+func requireScopeOrSelf(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			client, ok := c.Get(ClientContextKey).(Client)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			if client.HasScope(scope) {
+				return next(c)
+			}
+			if client.UserUUID == "" {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("the %s scope is required", scope))
+			}
+			if userUUID := c.Param("uuid"); userUUID != "" {
+				if err := requireSelf(c, scope, userUUID); err != nil {
+					return err
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireSelf rejects a request about a user from a client acting for a
+// different user, unless the client has been granted the scope.
+func requireSelf(c echo.Context, scope string, userUUID string) error {
+	client, ok := c.Get(ClientContextKey).(Client)
+	if ok && !client.HasScope(scope) && client.UserUUID != "" && client.UserUUID != userUUID {
+		return echo.NewHTTPError(http.StatusForbidden, "a user can only make this request for themselves")
+	}
+	return nil
+}
+
+// requestPrincipal returns the name of the client that made the request.
+func requestPrincipal(c echo.Context) *string {
+	if client, ok := c.Get(ClientContextKey).(Client); ok {
+		return &client.Name
+	}
+	return nil
+}
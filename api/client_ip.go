@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// clientIPContextKey is the key under which the IP address of the end user
+// is stored in the echo context.
+const clientIPContextKey = "client_ip"
+
+// DefaultTrustedProxies are the ranges proxies in front of the server, such
+// as the Cloud Foundry router, are trusted to be in when none are configured:
+// loopback, link-local and private addresses.
+var DefaultTrustedProxies = mustParseTrustedProxies("127.0.0.0/8,::1/128,169.254.0.0/16,fe80::/10,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7")
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and CIDR
+// ranges.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", part)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %s", part, err)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+func mustParseTrustedProxies(s string) []*net.IPNet {
+	ranges, err := ParseTrustedProxies(s)
+	if err != nil {
+		panic(err)
+	}
+	return ranges
+}
+
+// clientIP stores the IP address of the end user in the echo context. It
+// works back from the address the request came from through the
+// X-Forwarded-For header, to the first address that is not a trusted proxy,
+// as every entry before that could have been made up by the client.
+func clientIP(trusted []*net.IPNet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(clientIPContextKey, extractClientIP(c.Request(), trusted))
+			return next(c)
+		}
+	}
+}
+
+// requestClientIP returns the IP address of the end user, as stored by the
+// clientIP middleware or else found trusting the default proxies.
+func requestClientIP(c echo.Context) string {
+	if ip, ok := c.Get(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return extractClientIP(c.Request(), DefaultTrustedProxies)
+}
+
+func extractClientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	addresses := []string{remote}
+	forwarded := strings.Split(strings.Join(r.Header.Values(echo.HeaderXForwardedFor), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if address := strings.TrimSpace(forwarded[i]); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+
+	for i, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil && i == 0 {
+			return remote
+		} else if ip == nil {
+			// Anything before an entry that cannot be parsed cannot be
+			// trusted either, so the last proxy is as far back as it goes
+			return addresses[i-1]
+		}
+		if !isTrusted(ip, trusted) || i == len(addresses)-1 {
+			return ip.String()
+		}
+	}
+	return remote
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("Client IP", func() {
+	const userUUID = "00000000-0000-0000-0000-000000000001"
+
+	var store *database.MemoryStore
+
+	BeforeEach(func() {
+		store = database.NewMemoryStore()
+		Expect(store.PutDocument(context.Background(), database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Now().Add(-time.Hour),
+		})).To(Succeed())
+	})
+
+	recordedClientIP := func(trusted []*net.IPNet, remoteAddr string, forwardedFor string) string {
+		server := NewServer(Config{
+			DB:                store,
+			BasicAuthUsername: "jeff",
+			BasicAuthPassword: "jefferson",
+			TrustedProxies:    trusted,
+			LogWriter:         GinkgoWriter,
+		})
+
+		req := httptest.NewRequest(echo.POST, "/agreements", strings.NewReader(`{"user_uuid": "`+userUUID+`", "document_name": "document-one"}`))
+		req.RemoteAddr = remoteAddr
+		req.SetBasicAuth("jeff", "jefferson")
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if forwardedFor != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		}
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		Expect(res.Code).To(Equal(http.StatusCreated))
+
+		agreements, err := store.GetAgreementsForUserUUID(context.Background(), userUUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agreements).To(HaveLen(1))
+		Expect(agreements[0].ClientIP).ToNot(BeNil())
+		return *agreements[0].ClientIP
+	}
+
+	It("should record the address a request came from when it is not a trusted proxy", func() {
+		Expect(recordedClientIP(nil, "203.0.113.1:1234", "198.51.100.1")).To(Equal("203.0.113.1"))
+	})
+
+	It("should record the address added by the trusted proxy in front of the server", func() {
+		Expect(recordedClientIP(nil, "10.0.0.1:1234", "198.51.100.1")).To(Equal("198.51.100.1"))
+	})
+
+	It("should ignore addresses the client added before those of trusted proxies", func() {
+		Expect(recordedClientIP(nil, "10.0.0.1:1234", "203.0.113.9, 198.51.100.1, 10.0.0.2")).To(Equal("198.51.100.1"))
+	})
+
+	It("should believe proxies in the configured ranges", func() {
+		trusted, err := ParseTrustedProxies("198.51.100.0/24, 10.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recordedClientIP(trusted, "10.0.0.1:1234", "203.0.113.9, 198.51.100.1")).To(Equal("203.0.113.9"))
+	})
+
+	It("should not believe proxies outside the configured ranges", func() {
+		trusted, err := ParseTrustedProxies("198.51.100.0/24")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recordedClientIP(trusted, "10.0.0.1:1234", "203.0.113.9, 198.51.100.1")).To(Equal("10.0.0.1"))
+	})
+
+	It("should not look past an entry that is not an address", func() {
+		Expect(recordedClientIP(nil, "10.0.0.1:1234", "203.0.113.9, unknown, 10.0.0.2")).To(Equal("10.0.0.2"))
+	})
+
+	It("should reject invalid trusted proxies", func() {
+		_, err := ParseTrustedProxies("10.0.0.0/33")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseTrustedProxies("router")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Scopes that can be granted to a client. Each route requires one or more of
+// them.
+const (
+	ScopeDocumentsRead   = "documents:read"
+	ScopeDocumentsWrite  = "documents:write"
+	ScopeAgreementsRead  = "agreements:read"
+	ScopeAgreementsWrite = "agreements:write"
+	ScopeUsersRead       = "users:read"
+	ScopeUsersWrite      = "users:write"
+	ScopeMetricsRead     = "metrics:read"
+)
+
+// AllScopes is every scope a client can be granted.
+var AllScopes = []string{
+	ScopeDocumentsRead,
+	ScopeDocumentsWrite,
+	ScopeAgreementsRead,
+	ScopeAgreementsWrite,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeMetricsRead,
+}
+
+// Client is an application allowed to use the API. It authenticates with
+// basic auth using its name and any one of its secrets, of which only the
+// bcrypt hash is kept. Having more than one secret lets a client's secret be
+// rotated without downtime.
+type Client struct {
+	Name    string   `json:"name"`
+	Secrets []Secret `json:"secrets"`
+	Scopes  []string `json:"scopes"`
+	// UserUUID is set when the client is acting for a single user, who can
+	// use some routes for themselves without being granted their scope.
+	UserUUID string `json:"-"`
+}
+
+// Secret is one of the secrets a client can authenticate with. The ID is
+// logged when the secret is used, so it is possible to tell when an old
+// secret can be removed. A secret is not accepted after it expires.
+type Secret struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// legacySecretID is the ID of a secret given as a client's secret_hash.
+const legacySecretID = "secret_hash"
+
+func (secret Secret) expired(now time.Time) bool {
+	return secret.ExpiresAt != nil && !now.Before(*secret.ExpiresAt)
+}
+
+// HasScope reports whether the client has been granted a scope.
+func (client Client) HasScope(scope string) bool {
+	for _, s := range client.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseClients parses a JSON list of clients, such as the API_CLIENTS
+// environment variable, and checks that each one is usable.
+func ParseClients(data []byte) ([]Client, error) {
+	// Clients were first configured with a single secret_hash, which is
+	// still accepted as a secret that does not expire
+	var parsed []struct {
+		Client
+		SecretHash string `json:"secret_hash"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid clients: %s", err)
+	}
+
+	clients := []Client{}
+	for _, p := range parsed {
+		client := p.Client
+		if p.SecretHash != "" {
+			if len(client.Secrets) > 0 {
+				return nil, fmt.Errorf("invalid clients: %s has both secret_hash and secrets", client.Name)
+			}
+			client.Secrets = []Secret{{ID: legacySecretID, Hash: p.SecretHash}}
+		}
+		clients = append(clients, client)
+	}
+
+	names := map[string]bool{}
+	for _, client := range clients {
+		if client.Name == "" {
+			return nil, fmt.Errorf("invalid clients: a client has no name")
+		}
+		if names[client.Name] {
+			return nil, fmt.Errorf("invalid clients: %s is defined more than once", client.Name)
+		}
+		names[client.Name] = true
+
+		if len(client.Secrets) == 0 {
+			return nil, fmt.Errorf("invalid clients: %s has no secrets", client.Name)
+		}
+		ids := map[string]bool{}
+		for _, secret := range client.Secrets {
+			if secret.ID == "" {
+				return nil, fmt.Errorf("invalid clients: a secret of %s has no id", client.Name)
+			}
+			if ids[secret.ID] {
+				return nil, fmt.Errorf("invalid clients: %s has more than one secret with id %s", client.Name, secret.ID)
+			}
+			ids[secret.ID] = true
+
+			if _, err := bcrypt.Cost([]byte(secret.Hash)); err != nil {
+				return nil, fmt.Errorf("invalid clients: secret %s of %s is not a bcrypt hash: %s", secret.ID, client.Name, err)
+			}
+		}
+
+		for _, scope := range client.Scopes {
+			if !isScope(scope) {
+				return nil, fmt.Errorf("invalid clients: %s has unknown scope %s", client.Name, scope)
+			}
+		}
+	}
+
+	return clients, nil
+}
+
+func isScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// clientStore authenticates clients. Checking a bcrypt hash is deliberately
+// slow, so once a secret has been checked its SHA-256 is remembered and
+// compared instead on later requests.
+type clientStore struct {
+	clients  map[string]Client
+	verified sync.Map
+}
+
+func newClientStore(clients []Client) *clientStore {
+	store := &clientStore{clients: map[string]Client{}}
+	for _, client := range clients {
+		store.clients[client.Name] = client
+	}
+	return store
+}
+
+// Authenticate returns the client with the name, and the ID of the secret
+// used, if the secret is one of the client's unexpired secrets.
+func (store *clientStore) Authenticate(name string, secret string) (Client, string, bool) {
+	client, ok := store.clients[name]
+	if !ok {
+		return Client{}, "", false
+	}
+
+	now := time.Now()
+	sum := sha256.Sum256([]byte(secret))
+	for _, s := range client.Secrets {
+		if s.expired(now) {
+			continue
+		}
+		if verified, ok := store.verified.Load(verifiedKey(name, s.ID)); ok {
+			verifiedSum := verified.([sha256.Size]byte)
+			if subtle.ConstantTimeCompare(sum[:], verifiedSum[:]) == 1 {
+				return client, s.ID, true
+			}
+		}
+	}
+
+	for _, s := range client.Secrets {
+		if s.expired(now) {
+			continue
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(s.Hash), []byte(secret)); err == nil {
+			store.verified.Store(verifiedKey(name, s.ID), sum)
+			return client, s.ID, true
+		}
+	}
+
+	return Client{}, "", false
+}
+
+func verifiedKey(name string, secretID string) string {
+	return name + "/" + secretID
+}
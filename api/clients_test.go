@@ -0,0 +1,229 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+
+	. "github.com/alphagov/paas-accounts/api"
+)
+
+var _ = Describe("Clients", func() {
+	var secretHash, oldSecretHash string
+
+	BeforeEach(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("billing-secret"), bcrypt.MinCost)
+		Expect(err).ToNot(HaveOccurred())
+		secretHash = string(hash)
+
+		hash, err = bcrypt.GenerateFromPassword([]byte("old-billing-secret"), bcrypt.MinCost)
+		Expect(err).ToNot(HaveOccurred())
+		oldSecretHash = string(hash)
+	})
+
+	Describe("ParseClients", func() {
+		It("should parse a list of clients", func() {
+			clients, err := ParseClients([]byte(`[{
+				"name": "billing",
+				"secrets": [
+					{"id": "2020", "hash": "` + oldSecretHash + `", "expires_at": "2021-01-01T00:00:00Z"},
+					{"id": "2021", "hash": "` + secretHash + `"}
+				],
+				"scopes": ["users:read"]
+			}]`))
+			Expect(err).ToNot(HaveOccurred())
+			expiresAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+			Expect(clients).To(Equal([]Client{{
+				Name: "billing",
+				Secrets: []Secret{
+					{ID: "2020", Hash: oldSecretHash, ExpiresAt: &expiresAt},
+					{ID: "2021", Hash: secretHash},
+				},
+				Scopes: []string{ScopeUsersRead},
+			}}))
+		})
+
+		It("should accept a client with a single secret_hash as it was first configured", func() {
+			clients, err := ParseClients([]byte(`[{
+				"name": "billing",
+				"secret_hash": "` + secretHash + `",
+				"scopes": ["users:read"]
+			}]`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clients).To(Equal([]Client{{
+				Name:    "billing",
+				Secrets: []Secret{{ID: "secret_hash", Hash: secretHash}},
+				Scopes:  []string{ScopeUsersRead},
+			}}))
+		})
+
+		It("should reject a client with both secret_hash and secrets", func() {
+			_, err := ParseClients([]byte(`[{
+				"name": "billing",
+				"secret_hash": "` + secretHash + `",
+				"secrets": [{"id": "1", "hash": "` + secretHash + `"}]
+			}]`))
+			Expect(err).To(MatchError(ContainSubstring("billing has both secret_hash and secrets")))
+		})
+
+		It("should reject a client without a name", func() {
+			_, err := ParseClients([]byte(`[{"secrets": [{"id": "1", "hash": "` + secretHash + `"}]}]`))
+			Expect(err).To(MatchError(ContainSubstring("a client has no name")))
+		})
+
+		It("should reject clients with the same name", func() {
+			_, err := ParseClients([]byte(`[
+				{"name": "billing", "secrets": [{"id": "1", "hash": "` + secretHash + `"}]},
+				{"name": "billing", "secrets": [{"id": "1", "hash": "` + secretHash + `"}]}
+			]`))
+			Expect(err).To(MatchError(ContainSubstring("billing is defined more than once")))
+		})
+
+		It("should reject a client without secrets", func() {
+			_, err := ParseClients([]byte(`[{"name": "billing"}]`))
+			Expect(err).To(MatchError(ContainSubstring("billing has no secrets")))
+		})
+
+		It("should reject secrets with the same id", func() {
+			_, err := ParseClients([]byte(`[{"name": "billing", "secrets": [
+				{"id": "1", "hash": "` + secretHash + `"},
+				{"id": "1", "hash": "` + oldSecretHash + `"}
+			]}]`))
+			Expect(err).To(MatchError(ContainSubstring("billing has more than one secret with id 1")))
+		})
+
+		It("should reject a secret that is not a bcrypt hash", func() {
+			_, err := ParseClients([]byte(`[{"name": "billing", "secrets": [{"id": "1", "hash": "billing-secret"}]}]`))
+			Expect(err).To(MatchError(ContainSubstring("secret 1 of billing is not a bcrypt hash")))
+		})
+
+		It("should reject an unknown scope", func() {
+			_, err := ParseClients([]byte(`[
+				{"name": "billing", "secrets": [{"id": "1", "hash": "` + secretHash + `"}], "scopes": ["everything"]}
+			]`))
+			Expect(err).To(MatchError(ContainSubstring("billing has unknown scope everything")))
+		})
+	})
+
+	Describe("Config", func() {
+		It("should reject a client with the same name as the basic auth username", func() {
+			config := Config{
+				BasicAuthUsername: "billing",
+				BasicAuthPassword: "jefferson",
+				Clients: []Client{{
+					Name:    "billing",
+					Secrets: []Secret{{ID: "current", Hash: secretHash}},
+					Scopes:  []string{ScopeDocumentsRead},
+				}},
+			}
+			Expect(config.Check()).To(MatchError(ContainSubstring("more than one client is named billing")))
+			Expect(func() { NewServer(config) }).To(Panic())
+		})
+
+		It("should reject clients with the same name", func() {
+			client := Client{
+				Name:    "billing",
+				Secrets: []Secret{{ID: "current", Hash: secretHash}},
+			}
+			config := Config{Clients: []Client{client, client}}
+			Expect(config.Check()).To(MatchError(ContainSubstring("more than one client is named billing")))
+		})
+
+		It("should need a client", func() {
+			Expect(Config{}.Check()).To(MatchError(ContainSubstring("at least one client")))
+		})
+	})
+
+	Describe("authentication", func() {
+		var server *Server
+
+		BeforeEach(func() {
+			expired := time.Now().Add(-time.Hour)
+			server = NewServer(Config{
+				BasicAuthUsername:         "jeff",
+				BasicAuthPassword:         "jefferson",
+				BasicAuthPreviousPassword: "jefferson-old",
+				Clients: []Client{{
+					Name: "billing",
+					Secrets: []Secret{
+						{ID: "current", Hash: secretHash},
+						{ID: "expired", Hash: oldSecretHash, ExpiresAt: &expired},
+					},
+					Scopes: []string{ScopeDocumentsRead},
+				}},
+				LogWriter: GinkgoWriter,
+			})
+		})
+
+		request := func(method, path, username, password string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			req.SetBasicAuth(username, password)
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			return res
+		}
+
+		It("should reject a client with the wrong secret", func() {
+			res := request(echo.GET, "/users/00000000-0000-0000-0000-000000000001", "billing", "wrong")
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject a request that needs a scope the client does not have", func() {
+			res := request(echo.GET, "/users/00000000-0000-0000-0000-000000000001", "billing", "billing-secret")
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+			Expect(res.Body.String()).To(MatchJSON(`{
+				"message": "the users:read scope is required",
+				"request_id": "` + res.Header().Get(echo.HeaderXRequestID) + `"
+			}`))
+
+			res = request(echo.PUT, "/documents/doc-one", "billing", "billing-secret")
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("should keep rejecting the wrong secret once the right one has been used", func() {
+			res := request(echo.PUT, "/documents/doc-one", "billing", "billing-secret")
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+
+			res = request(echo.PUT, "/documents/doc-one", "billing", "wrong")
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should log which secret was used", func() {
+			var logs bytes.Buffer
+			server = NewServer(Config{
+				BasicAuthUsername:         "jeff",
+				BasicAuthPassword:         "jefferson",
+				BasicAuthPreviousPassword: "jefferson-old",
+				LogWriter:                 &logs,
+			})
+
+			request(echo.DELETE, "/users/not-a-uuid", "jeff", "jefferson-old")
+			Expect(logs.String()).To(ContainSubstring(`"secret":"previous"`))
+			Expect(logs.String()).To(ContainSubstring(`"client":"jeff"`))
+		})
+
+		It("should reject an expired secret", func() {
+			res := request(echo.PUT, "/documents/doc-one", "billing", "old-billing-secret")
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should grant every scope to the basic auth username", func() {
+			res := request(echo.DELETE, "/users/not-a-uuid", "jeff", "jefferson")
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should accept the previous basic auth password while it is rotated", func() {
+			res := request(echo.DELETE, "/users/not-a-uuid", "jeff", "jefferson-old")
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+
+			res = request(echo.DELETE, "/users/not-a-uuid", "jeff", "jefferson-older")
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DeleteUserHandler erases the personal data held about a user. The user's
+// UUID, agreements and revocations are kept as evidence.
+func DeleteUserHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userUUID := c.Param("uuid")
+		if _, err := uuid.FromString(userUUID); err != nil {
+			return BadRequestError{fmt.Sprintf("bad uuid: %s", userUUID)}
+		}
+
+		user, err := db.EraseUser(c.Request().Context(), userUUID, requestPrincipal(c))
+		if err != nil {
+			if err == database.ErrUserNotFound {
+				return userNotFoundError
+			}
+			return err
+		}
+
+		return c.JSON(http.StatusOK, user)
+	}
+}
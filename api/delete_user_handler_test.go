@@ -0,0 +1,100 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("DeleteUserHandler", func() {
+	var (
+		db   *database.MemoryStore
+		user database.User
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+
+		user = database.User{
+			UUID:     "00000000-0000-0000-0000-000000000001",
+			Username: strPoint("example@example.com"),
+			Email:    strPoint("example@example.com"),
+		}
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
+
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	deleteUser := func(userUUID string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(echo.DELETE, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid")
+		ctx.Set(ClientContextKey, Client{Name: "jeff"})
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(userUUID)
+
+		handler := DeleteUserHandler(db)
+		return res, handler(ctx)
+	}
+
+	It("should erase the user's personal data and keep their agreements", func() {
+		res, err := deleteUser(user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		var erased database.User
+		Expect(json.Unmarshal(res.Body.Bytes(), &erased)).To(Succeed())
+		Expect(erased.UUID).To(Equal(user.UUID))
+		Expect(erased.Email).To(BeNil())
+		Expect(erased.Username).To(BeNil())
+		Expect(erased.ErasedAt).ToNot(BeNil())
+
+		erasure, err := db.GetErasure(context.Background(), user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(erasure).ToNot(BeNil())
+		Expect(erasure.Principal).To(Equal(strPoint("jeff")))
+
+		agreements, err := db.GetAgreementsForUserUUID(context.Background(), user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agreements).To(HaveLen(1))
+	})
+
+	It("should succeed when the user has already been erased", func() {
+		_, err := deleteUser(user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := deleteUser(user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should return a 404 when the user doesn't exist", func() {
+		_, err := deleteUser("00000000-0000-0000-0000-000000000002")
+		Expect(err).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+
+	It("should return a 400 when the uuid is invalid", func() {
+		_, err := deleteUser("not-a-uuid")
+		Expect(err).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+})
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"github.com/alphagov/paas-accounts/database"
 	"github.com/go-playground/validator"
 	"github.com/labstack/echo"
 	"net/http"
@@ -15,6 +17,46 @@ func (err NotFoundError) Error() string {
 	return err.Message
 }
 
+type BadRequestError struct {
+	Message string
+}
+
+func (err BadRequestError) Error() string {
+	return err.Message
+}
+
+type ConflictError struct {
+	Message string
+	Field   string
+}
+
+func (err ConflictError) Error() string {
+	return err.Message
+}
+
+type UnprocessableEntityError struct {
+	Message string
+}
+
+func (err UnprocessableEntityError) Error() string {
+	return err.Message
+}
+
+type ServiceUnavailableError struct {
+	Message string
+}
+
+func (err ServiceUnavailableError) Error() string {
+	return err.Message
+}
+
+type GatewayTimeoutError struct {
+	Message string
+}
+
+func (err GatewayTimeoutError) Error() string {
+	return err.Message
+}
 
 type InternalServerError struct {
 	InternalError error
@@ -33,11 +75,19 @@ func (err ValidationError) Error() string {
 }
 
 type messageErrorBody struct {
-	Message string `json:"message"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type conflictErrorBody struct {
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 type validationErrorsBody struct {
 	ValidationErrors []fieldValidationError `json:"validation-errors"`
+	RequestID        string                 `json:"request_id,omitempty"`
 }
 
 type fieldValidationError struct {
@@ -53,39 +103,140 @@ func ErrorHandler(err error, ctx echo.Context) {
 	case NotFoundError:
 		handleNotFound(err.(NotFoundError), ctx)
 
+	case BadRequestError:
+		handleBadRequest(err.(BadRequestError), ctx)
+
+	case ConflictError:
+		handleConflict(err.(ConflictError), ctx)
+
+	case UnprocessableEntityError:
+		handleUnprocessableEntity(err.(UnprocessableEntityError), ctx)
+
+	case ServiceUnavailableError:
+		handleServiceUnavailable(err.(ServiceUnavailableError), ctx)
+
+	case GatewayTimeoutError:
+		handleGatewayTimeout(err.(GatewayTimeoutError), ctx)
+
 	case InternalServerError:
+		// Handlers wrap any error they do not expect, which includes a
+		// database query being cancelled or running out of time
+		if apiErr := fromContextError(err.(InternalServerError).InternalError); apiErr != nil {
+			ErrorHandler(apiErr, ctx)
+			return
+		}
 		handleInternalServerError(err.(InternalServerError), ctx)
 
 	case ValidationError:
 		handleValidationError(err.(ValidationError), ctx)
 
 	default:
+		if apiErr := fromDatabaseError(err); apiErr != nil {
+			if errors.Is(err, database.ErrInvalidInput) {
+				// The message from Postgres names the columns and
+				// constraints involved, so it is only logged
+				logError(ctx, err)
+			}
+			ErrorHandler(apiErr, ctx)
+			return
+		}
 		handleGenericError(err, ctx)
 	}
 }
 
+// fromDatabaseError maps the typed errors returned by the database package to
+// the API error they should be reported as. Handlers can return these errors
+// as they are. It returns nil for any other error.
+func fromDatabaseError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		return userNotFoundError
+	case errors.Is(err, database.ErrDocumentNotFound):
+		return ErrDocumentNotFound
+	case errors.Is(err, database.ErrAgreementNotFound):
+		return ErrAgreementNotFound
+	case errors.Is(err, database.ErrAgreementDocumentNotFound):
+		return UnprocessableEntityError{"no version of the document exists to agree to"}
+	case errors.Is(err, database.ErrAgreementDocumentSuperseded):
+		return ConflictError{Message: "the version of the document has been superseded"}
+	case errors.Is(err, database.ErrAgreementDocumentHashMismatch):
+		return ConflictError{Message: "the content of the document does not match the version agreed to"}
+	case errors.Is(err, database.ErrDocumentHistoryConflict):
+		return ConflictError{Message: "a version of the document is already scheduled at or after valid_from"}
+	case errors.Is(err, database.ErrImmutable):
+		return ConflictError{Message: "history cannot be modified"}
+	case errors.Is(err, database.ErrUserExists):
+		return ConflictError{Message: "a user with this uuid already exists", Field: "user_uuid"}
+	case errors.Is(err, database.ErrUsernameTaken):
+		return ConflictError{Message: "a user with this username already exists", Field: "username"}
+	case errors.Is(err, database.ErrUserErased):
+		return ConflictError{Message: "the user has been erased"}
+	case errors.Is(err, database.ErrInvalidInput):
+		return BadRequestError{"the request contains a value that is not valid"}
+	}
 
+	return fromContextError(err)
+}
+
+// fromContextError reports a database query that was cancelled, because the
+// client went away or the server is shutting down, as a 503, and one that ran
+// out of time as a 504. It returns nil for any other error.
+func fromContextError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrCanceled):
+		return ServiceUnavailableError{"the request was cancelled before the database answered"}
+	case errors.Is(err, database.ErrTimeout):
+		return GatewayTimeoutError{"the database did not answer in time"}
+	}
+
+	return nil
+}
 
 func handleEchoHTTPError(err *echo.HTTPError, ctx echo.Context) {
 	code := err.Code
-	body := messageErrorBody{ Message: fmt.Sprintf("%v", err.Message) }
+	body := messageErrorBody{Message: fmt.Sprintf("%v", err.Message), RequestID: requestID(ctx)}
 
-	ctx.Logger().Error(err)
+	logError(ctx, err)
 	ctx.JSON(code, body)
 }
 
 func handleNotFound(err NotFoundError, ctx echo.Context) {
-	ctx.Logger().Error(err)
-	ctx.JSON(http.StatusNotFound, messageErrorBody{ Message: err.Error() })
+	logError(ctx, err)
+	ctx.JSON(http.StatusNotFound, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
+}
+
+func handleBadRequest(err BadRequestError, ctx echo.Context) {
+	logError(ctx, err)
+	ctx.JSON(http.StatusBadRequest, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
+}
+
+func handleConflict(err ConflictError, ctx echo.Context) {
+	logError(ctx, err)
+	ctx.JSON(http.StatusConflict, conflictErrorBody{Message: err.Error(), Field: err.Field, RequestID: requestID(ctx)})
+}
+
+func handleUnprocessableEntity(err UnprocessableEntityError, ctx echo.Context) {
+	logError(ctx, err)
+	ctx.JSON(http.StatusUnprocessableEntity, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
+}
+
+func handleServiceUnavailable(err ServiceUnavailableError, ctx echo.Context) {
+	logError(ctx, err)
+	ctx.JSON(http.StatusServiceUnavailable, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
+}
+
+func handleGatewayTimeout(err GatewayTimeoutError, ctx echo.Context) {
+	logError(ctx, err)
+	ctx.JSON(http.StatusGatewayTimeout, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
 }
 
 func handleInternalServerError(err InternalServerError, ctx echo.Context) {
-	ctx.Logger().Error(err.InternalError)
-	ctx.NoContent(http.StatusInternalServerError)
+	logError(ctx, err.InternalError)
+	ctx.JSON(http.StatusInternalServerError, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
 }
 
 func handleValidationError(err ValidationError, ctx echo.Context) {
-	body := validationErrorsBody{ ValidationErrors: []fieldValidationError{} }
+	body := validationErrorsBody{ValidationErrors: []fieldValidationError{}, RequestID: requestID(ctx)}
 
 	for _, field := range err.ValidationErrors {
 		fieldErr := fieldValidationError{
@@ -96,11 +247,11 @@ func handleValidationError(err ValidationError, ctx echo.Context) {
 		body.ValidationErrors = append(body.ValidationErrors, fieldErr)
 	}
 
-	ctx.Logger().Error(err)
+	logError(ctx, err)
 	ctx.JSON(http.StatusBadRequest, body)
 }
 
 func handleGenericError(err error, ctx echo.Context) {
-	ctx.Logger().Error(err)
-	ctx.JSON(http.StatusInternalServerError, messageErrorBody{ Message: err.Error() })
+	logError(ctx, err)
+	ctx.JSON(http.StatusInternalServerError, messageErrorBody{Message: err.Error(), RequestID: requestID(ctx)})
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/alphagov/paas-accounts/diff"
+	"github.com/alphagov/paas-accounts/markdown"
+	"github.com/labstack/echo"
+)
+
+// diffContext is how many unchanged lines are shown around each change.
+const diffContext = 3
+
+type documentDiff struct {
+	Name        string              `json:"name"`
+	From        documentDiffVersion `json:"from"`
+	To          documentDiffVersion `json:"to"`
+	Granularity string              `json:"granularity"`
+	Diff        string              `json:"diff"`
+	HTML        string              `json:"html"`
+}
+
+type documentDiffVersion struct {
+	Version   int       `json:"version"`
+	ValidFrom time.Time `json:"valid_from"`
+}
+
+// GetDocumentDiffHandler compares the versions of a document in force at
+// the from and to RFC3339 timestamps. Without to, it compares against the
+// version in force now, and without from, against the version before to.
+func GetDocumentDiffHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		name := c.Param("name")
+
+		granularity := c.QueryParam("granularity")
+		if granularity == "" {
+			granularity = "line"
+		}
+		if granularity != "line" && granularity != "word" {
+			return BadRequestError{"granularity must be line or word"}
+		}
+
+		to := time.Now()
+		if param := c.QueryParam("to"); param != "" {
+			var err error
+			to, err = time.Parse(time.RFC3339, param)
+			if err != nil {
+				return BadRequestError{"to must be an RFC3339 timestamp"}
+			}
+		}
+		var from time.Time
+		if param := c.QueryParam("from"); param != "" {
+			var err error
+			from, err = time.Parse(time.RFC3339, param)
+			if err != nil {
+				return BadRequestError{"from must be an RFC3339 timestamp"}
+			}
+		}
+
+		toVersion, err := db.GetDocumentVersionAt(ctx, name, to)
+		if err == database.ErrDocumentNotFound {
+			return ErrDocumentVersionNotFound
+		} else if err != nil {
+			return InternalServerError{err}
+		}
+
+		var fromVersion database.DocumentVersion
+		if !from.IsZero() {
+			fromVersion, err = db.GetDocumentVersionAt(ctx, name, from)
+		} else if toVersion.Version > 1 {
+			fromVersion, err = db.GetDocumentVersion(ctx, name, toVersion.Version-1)
+		} else {
+			return NotFoundError{"there is no earlier version of the document to compare with"}
+		}
+		if err == database.ErrDocumentNotFound {
+			return ErrDocumentVersionNotFound
+		} else if err != nil {
+			return InternalServerError{err}
+		}
+
+		fromName := fmt.Sprintf("%s@%s", name, fromVersion.ValidFrom.UTC().Format(time.RFC3339Nano))
+		toName := fmt.Sprintf("%s@%s", name, toVersion.ValidFrom.UTC().Format(time.RFC3339Nano))
+		edits := diff.Lines(fromVersion.Content, toVersion.Content)
+		unified := diff.Unified(fromName, toName, edits, diffContext)
+		if granularity == "word" {
+			unified = diff.WordUnified(fromName, toName, edits, diffContext)
+		}
+
+		html, err := markdown.DiffHTML(fromVersion.Content, toVersion.Content)
+		if err != nil {
+			return InternalServerError{err}
+		}
+
+		return c.JSON(http.StatusOK, documentDiff{
+			Name:        name,
+			From:        documentDiffVersion{fromVersion.Version, fromVersion.ValidFrom},
+			To:          documentDiffVersion{toVersion.Version, toVersion.ValidFrom},
+			Granularity: granularity,
+			Diff:        unified,
+			HTML:        html,
+		})
+	}
+}
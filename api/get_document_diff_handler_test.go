@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetDocumentDiffHandler", func() {
+	var (
+		db     *database.MemoryStore
+		first  = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+		second = time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC)
+		third  = time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+		for _, version := range []database.Document{
+			{Name: "terms", ValidFrom: first, Content: "# Terms\n\nYou must pay within 30 days.\n"},
+			{Name: "terms", ValidFrom: second, Content: "# Terms\n\nYou must pay within 60 days.\n"},
+			{Name: "terms", ValidFrom: third, Content: "# Terms\n\nYou must pay within 60 days.\n\nWe may end this agreement.\n"},
+		} {
+			Expect(db.PutDocument(context.Background(), version)).To(Succeed())
+		}
+	})
+
+	get := func(query url.Values) (map[string]interface{}, error) {
+		req := httptest.NewRequest(echo.GET, "/?"+query.Encode(), nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/diff")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("terms")
+
+		if err := GetDocumentDiffHandler(db)(ctx); err != nil {
+			return nil, err
+		}
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		var body map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &body)).To(Succeed())
+		return body, nil
+	}
+
+	It("should compare two versions line by line", func() {
+		body, err := get(url.Values{"from": {first.Format(time.RFC3339)}, "to": {second.Format(time.RFC3339)}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(HaveKeyWithValue("from", map[string]interface{}{"version": 1.0, "valid_from": "2001-01-01T00:00:00Z"}))
+		Expect(body).To(HaveKeyWithValue("to", map[string]interface{}{"version": 2.0, "valid_from": "2002-01-01T00:00:00Z"}))
+		Expect(body).To(HaveKeyWithValue("granularity", "line"))
+		Expect(body["diff"]).To(Equal(
+			"--- terms@2001-01-01T00:00:00Z\n" +
+				"+++ terms@2002-01-01T00:00:00Z\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" # Terms\n" +
+				" \n" +
+				"-You must pay within 30 days.\n" +
+				"+You must pay within 60 days.\n",
+		))
+		Expect(body["html"]).To(Equal(
+			"<h1>Terms</h1>\n" +
+				"<del><p>You must pay within 30 days.</p></del>\n" +
+				"<ins><p>You must pay within 60 days.</p></ins>\n",
+		))
+	})
+
+	It("should compare two versions word by word", func() {
+		body, err := get(url.Values{"from": {first.Format(time.RFC3339)}, "to": {second.Format(time.RFC3339)}, "granularity": {"word"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body["diff"]).To(ContainSubstring("You must pay within [-30-]{+60+} days.\n"))
+	})
+
+	It("should compare the version in force with the one before it by default", func() {
+		body, err := get(url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body["from"]).To(HaveKeyWithValue("version", 2.0))
+		Expect(body["to"]).To(HaveKeyWithValue("version", 3.0))
+		Expect(body["diff"]).To(ContainSubstring("+We may end this agreement.\n"))
+	})
+
+	It("should find the versions in force at the times given", func() {
+		body, err := get(url.Values{"from": {"2001-06-01T00:00:00Z"}, "to": {"2003-06-01T00:00:00Z"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body["from"]).To(HaveKeyWithValue("version", 1.0))
+		Expect(body["to"]).To(HaveKeyWithValue("version", 3.0))
+	})
+
+	It("should be empty when comparing a version with itself", func() {
+		body, err := get(url.Values{"from": {second.Format(time.RFC3339)}, "to": {second.Format(time.RFC3339)}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body["diff"]).To(BeEmpty())
+	})
+
+	It("should return a 404 when there is no earlier version", func() {
+		_, err := get(url.Values{"to": {first.Format(time.RFC3339)}})
+		Expect(err).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+
+	It("should return a 404 before the first version", func() {
+		_, err := get(url.Values{"from": {"2000-01-01T00:00:00Z"}})
+		Expect(err).To(Equal(ErrDocumentVersionNotFound))
+	})
+
+	DescribeTable("should reject invalid parameters",
+		func(query url.Values, message string) {
+			_, err := get(query)
+			Expect(err).To(Equal(BadRequestError{message}))
+		},
+		Entry("from", url.Values{"from": {"yesterday"}}, "from must be an RFC3339 timestamp"),
+		Entry("to", url.Values{"to": {"1"}}, "to must be an RFC3339 timestamp"),
+		Entry("granularity", url.Values{"granularity": {"character"}}, "granularity must be line or word"),
+	)
+})
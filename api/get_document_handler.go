@@ -2,22 +2,55 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/alphagov/paas-accounts/database"
+	"github.com/alphagov/paas-accounts/markdown"
 	"github.com/labstack/echo"
 )
 
 var ErrDocumentNotFound = NotFoundError{"document not found"}
 
-func GetDocumentHandler(db *database.DB) echo.HandlerFunc {
+const (
+	mimeTextMarkdown = "text/markdown"
+	// documentHTMLCacheSize is how many rendered versions NewServer keeps.
+	// There are only a handful of documents, each with a few versions.
+	documentHTMLCacheSize = 100
+)
+
+// GetDocumentHandler returns a document as JSON, as the markdown it is
+// stored as, or rendered to HTML, depending on the Accept header.
+func GetDocumentHandler(db database.Store, renderer *markdown.Renderer) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		document, err := db.GetDocument(c.Param("name"))
+		format := negotiate(c, echo.MIMEApplicationJSON, mimeTextMarkdown, echo.MIMETextHTML)
+		if format == "" {
+			return echo.NewHTTPError(http.StatusNotAcceptable, "documents are available as application/json, text/markdown or text/html")
+		}
+
+		getDocument := db.GetDocument
+		if c.QueryParam("upcoming") == "true" {
+			getDocument = db.GetUpcomingDocument
+		}
+
+		document, err := getDocument(c.Request().Context(), c.Param("name"))
 		if err == database.ErrDocumentNotFound {
 			return ErrDocumentNotFound
 		} else if err != nil {
 			return InternalServerError{err}
 		}
 
+		switch format {
+		case mimeTextMarkdown:
+			return c.Blob(http.StatusOK, mimeTextMarkdown+"; charset=utf-8", []byte(document.Content))
+		case echo.MIMETextHTML:
+			html, err := renderer.HTML(document.Name+"@"+document.ValidFrom.UTC().Format(time.RFC3339Nano), document.Content)
+			if err != nil {
+				return InternalServerError{err}
+			}
+			c.Response().Header().Set("Content-Security-Policy", "default-src 'none'")
+			return c.HTML(http.StatusOK, html)
+		}
+
 		return c.JSON(http.StatusOK, document)
 	}
 }
@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"time"
@@ -11,28 +12,14 @@ import (
 
 	. "github.com/alphagov/paas-accounts/api"
 	"github.com/alphagov/paas-accounts/database"
+	"github.com/alphagov/paas-accounts/markdown"
 )
 
 var _ = Describe("GetDocumentHandler", func() {
-	var (
-		db     *database.DB
-		tempDB *database.TempDB
-	)
+	var db *database.MemoryStore
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
-	})
-
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
+		db = database.NewMemoryStore()
 	})
 
 	It("should get a document", func() {
@@ -41,7 +28,7 @@ var _ = Describe("GetDocumentHandler", func() {
 			Content:   "content one",
 			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
 		}
-		Expect(db.PutDocument(input)).To(Succeed())
+		Expect(db.PutDocument(context.Background(), input)).To(Succeed())
 
 		req := httptest.NewRequest(echo.GET, "/", nil)
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -51,7 +38,7 @@ var _ = Describe("GetDocumentHandler", func() {
 		ctx.SetParamNames("name")
 		ctx.SetParamValues(input.Name)
 
-		handler := GetDocumentHandler(db)
+		handler := GetDocumentHandler(db, markdown.NewRenderer(10))
 		Expect(handler(ctx)).To(Succeed())
 		Expect(res.Body).To(MatchJSON(`{
 			"name": "one",
@@ -71,7 +58,116 @@ var _ = Describe("GetDocumentHandler", func() {
 		ctx.SetParamNames("name")
 		ctx.SetParamValues("one")
 
-		handler := GetDocumentHandler(db)
+		handler := GetDocumentHandler(db, markdown.NewRenderer(10))
 		Expect(handler(ctx)).To(BeAssignableToTypeOf(NotFoundError{}))
 	})
+
+	It("should get the upcoming version of a document", func() {
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "upcoming content",
+			ValidFrom: time.Now().Add(24 * time.Hour),
+		})).To(Succeed())
+
+		req := httptest.NewRequest(echo.GET, "/?upcoming=true", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := GetDocumentHandler(db, markdown.NewRenderer(10))
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring(`"content":"upcoming content"`))
+	})
+})
+
+var _ = Describe("GetDocumentHandler content negotiation", func() {
+	var (
+		db       *database.MemoryStore
+		renderer *markdown.Renderer
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+		renderer = markdown.NewRenderer(10)
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "# Terms\n\n<script>alert(1)</script>\n\n*content*\n",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	get := func(accept string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		return res, GetDocumentHandler(db, renderer)(ctx)
+	}
+
+	DescribeTable("should choose the format from the Accept header",
+		func(accept, contentType string) {
+			res, err := get(accept)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get(echo.HeaderContentType)).To(Equal(contentType))
+			Expect(res.Header().Get(echo.HeaderVary)).To(Equal("Accept"))
+		},
+		Entry("no Accept header", "", echo.MIMEApplicationJSONCharsetUTF8),
+		Entry("anything", "*/*", echo.MIMEApplicationJSONCharsetUTF8),
+		Entry("JSON", "application/json", echo.MIMEApplicationJSONCharsetUTF8),
+		Entry("markdown", "text/markdown", "text/markdown; charset=utf-8"),
+		Entry("HTML", "text/html", echo.MIMETextHTMLCharsetUTF8),
+		Entry("a browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", echo.MIMETextHTMLCharsetUTF8),
+		Entry("any text", "text/*", "text/markdown; charset=utf-8"),
+		Entry("a preference by quality", "text/html;q=0.5, text/markdown;q=0.9", "text/markdown; charset=utf-8"),
+		Entry("a type that is refused", "text/*, text/markdown;q=0", echo.MIMETextHTMLCharsetUTF8),
+	)
+
+	It("should return the markdown as it is stored", func() {
+		res, err := get("text/markdown")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Body.String()).To(Equal("# Terms\n\n<script>alert(1)</script>\n\n*content*\n"))
+	})
+
+	It("should render sanitised HTML", func() {
+		res, err := get("text/html")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Body.String()).To(Equal("<h1>Terms</h1>\n\n<p><em>content</em></p>\n"))
+		Expect(res.Header().Get("Content-Security-Policy")).To(Equal("default-src 'none'"))
+		Expect(renderer.Len()).To(Equal(1))
+	})
+
+	It("should render each version separately", func() {
+		_, err := get("text/html")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "*new content*",
+			ValidFrom: time.Now(),
+		})).To(Succeed())
+
+		res, err := get("text/html")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Body.String()).To(Equal("<p><em>new content</em></p>\n"))
+		Expect(renderer.Len()).To(Equal(2))
+	})
+
+	It("should refuse a format it can't return", func() {
+		_, err := get("application/pdf")
+		Expect(err).To(Equal(echo.NewHTTPError(http.StatusNotAcceptable, "documents are available as application/json, text/markdown or text/html")))
+	})
 })
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+)
+
+var ErrDocumentVersionNotFound = NotFoundError{"document version not found"}
+
+func GetDocumentVersionsHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		versions, err := db.GetDocumentVersions(c.Request().Context(), c.Param("name"))
+		if err == database.ErrDocumentNotFound {
+			return ErrDocumentNotFound
+		} else if err != nil {
+			return InternalServerError{err}
+		}
+
+		return c.JSON(http.StatusOK, versions)
+	}
+}
+
+// GetDocumentVersionHandler fetches a single version of a document, either
+// by its ordinal version number or by an RFC3339 timestamp, in which case
+// the version that was the latest at that time is returned.
+func GetDocumentVersionHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		param, err := url.PathUnescape(c.Param("version"))
+		if err != nil {
+			return BadRequestError{"version must be a version number or an RFC3339 timestamp"}
+		}
+
+		var version database.DocumentVersion
+		if n, convErr := strconv.Atoi(param); convErr == nil {
+			version, err = db.GetDocumentVersion(c.Request().Context(), c.Param("name"), n)
+		} else if at, parseErr := time.Parse(time.RFC3339, param); parseErr == nil {
+			version, err = db.GetDocumentVersionAt(c.Request().Context(), c.Param("name"), at)
+		} else {
+			return BadRequestError{"version must be a version number or an RFC3339 timestamp"}
+		}
+
+		if err == database.ErrDocumentNotFound {
+			return ErrDocumentVersionNotFound
+		} else if err != nil {
+			return InternalServerError{err}
+		}
+
+		return c.JSON(http.StatusOK, version)
+	}
+}
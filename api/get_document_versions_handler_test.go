@@ -0,0 +1,128 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetDocumentVersionsHandler", func() {
+	var db *database.MemoryStore
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "content two",
+			ValidFrom: time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+
+		Expect(db.PostUser(context.Background(), database.User{UUID: "00000000-0000-0000-0000-000000000001"})).To(Succeed())
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     "00000000-0000-0000-0000-000000000001",
+			DocumentName: "one",
+			Date:         time.Date(2001, 6, 1, 0, 0, 0, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	It("should list the versions of a document", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/versions")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := GetDocumentVersionsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"name": "one",
+				"version": 1,
+				"content": "content one",
+				"valid_from": "2001-01-01T01:01:01Z",
+				"content_hash": "` + database.ContentHash("content one") + `",
+				"agreement_count": 1
+			},
+			{
+				"name": "one",
+				"version": 2,
+				"content": "content two",
+				"valid_from": "2002-02-02T02:02:02Z",
+				"content_hash": "` + database.ContentHash("content two") + `",
+				"agreement_count": 0
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
+	})
+
+	It("should return a 404 for a document that doesn't exist", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/versions")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("two")
+
+		handler := GetDocumentVersionsHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+
+	DescribeTable("should get a single version",
+		func(version string, expectedContent string) {
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			res := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, res)
+			ctx.SetPath("/documents/:name/versions/:version")
+			ctx.SetParamNames("name", "version")
+			ctx.SetParamValues("one", version)
+
+			handler := GetDocumentVersionHandler(db)
+			Expect(handler(ctx)).To(Succeed())
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Body.String()).To(ContainSubstring(`"content":"` + expectedContent + `"`))
+		},
+		Entry("by version number", "1", "content one"),
+		Entry("by timestamp", "2001-12-25T00:00:00Z", "content one"),
+		Entry("by exact valid_from", "2002-02-02T02:02:02Z", "content two"),
+	)
+
+	It("should return a 404 for a version that doesn't exist", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/versions/:version")
+		ctx.SetParamNames("name", "version")
+		ctx.SetParamValues("one", "3")
+
+		handler := GetDocumentVersionHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+
+	It("should reject a version that is neither a number nor a timestamp", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/versions/:version")
+		ctx.SetParamNames("name", "version")
+		ctx.SetParamValues("one", "latest")
+
+		handler := GetDocumentVersionHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+})
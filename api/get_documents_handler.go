@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+)
+
+func GetDocumentsHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		updatedSince, err := parseTimeParam(c, "updated_since")
+		if err != nil {
+			return err
+		}
+
+		documents, err := db.GetDocuments(c.Request().Context(), updatedSince)
+		if err != nil {
+			return InternalServerError{err}
+		}
+
+		return c.JSON(http.StatusOK, documents)
+	}
+}
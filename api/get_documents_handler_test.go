@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetDocumentsHandler", func() {
+	var db *database.MemoryStore
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "two",
+			Content:   "content two",
+			ValidFrom: time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	It("should list all documents", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents")
+
+		handler := GetDocumentsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"name": "one",
+				"valid_from": "2001-01-01T01:01:01Z",
+				"version_count": 1,
+				"content_hash": "` + database.ContentHash("content one") + `"
+			},
+			{
+				"name": "two",
+				"valid_from": "2002-02-02T02:02:02Z",
+				"version_count": 1,
+				"content_hash": "` + database.ContentHash("content two") + `"
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
+	})
+
+	It("should list documents updated since a given time", func() {
+		q := url.Values{
+			"updated_since": []string{"2001-06-01T00:00:00Z"},
+		}
+		req := httptest.NewRequest(echo.GET, "/?"+q.Encode(), nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents")
+
+		handler := GetDocumentsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"name": "two",
+				"valid_from": "2002-02-02T02:02:02Z",
+				"version_count": 1,
+				"content_hash": "` + database.ContentHash("content two") + `"
+			}
+		]`))
+	})
+
+	It("should reject a malformed updated_since", func() {
+		req := httptest.NewRequest(echo.GET, "/?updated_since=yesterday", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents")
+
+		handler := GetDocumentsHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+})
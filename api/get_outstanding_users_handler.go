@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+)
+
+const MIMETextCSV = "text/csv"
+
+// GetOutstandingUsersHandler lists the users who have not agreed to the
+// version of a document currently in force, as JSON or, when requested with
+// ?format=csv or preferred by the Accept header, as CSV.
+func GetOutstandingUsersHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		format := MIMETextCSV
+		if c.QueryParam("format") != "csv" {
+			format = negotiate(c, echo.MIMEApplicationJSON, MIMETextCSV)
+			if format == "" {
+				return echo.NewHTTPError(http.StatusNotAcceptable, "outstanding users are available as application/json or text/csv")
+			}
+		}
+
+		limit, offset, err := parsePagination(c)
+		if err != nil {
+			return err
+		}
+
+		users, err := db.GetUsersWithOutstandingDocument(c.Request().Context(), c.Param("name"), limit, offset)
+		if err == database.ErrDocumentNotFound {
+			return ErrDocumentNotFound
+		} else if err != nil {
+			return InternalServerError{err}
+		}
+
+		if format == MIMETextCSV {
+			return writeUsersCSV(c, users)
+		}
+
+		return c.JSON(http.StatusOK, users)
+	}
+}
+
+func writeUsersCSV(c echo.Context, users []database.User) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIMETextCSV+"; charset=UTF-8")
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"user_uuid", "user_email", "username"})
+	for _, user := range users {
+		w.Write([]string{user.UUID, csvCell(derefString(user.Email)), csvCell(derefString(user.Username))})
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// csvCell stops a value being read as a formula when the CSV is opened in a
+// spreadsheet, by quoting it if it starts with a character that begins one.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func derefString(str *string) string {
+	if str == nil {
+		return ""
+	}
+	return *str
+}
@@ -0,0 +1,153 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetOutstandingUsersHandler", func() {
+	var db *database.MemoryStore
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+
+		Expect(db.PostUser(context.Background(), database.User{
+			UUID:     "00000000-0000-0000-0000-000000000001",
+			Email:    strPoint("agreed@example.com"),
+			Username: strPoint("agreed@example.com"),
+		})).To(Succeed())
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     "00000000-0000-0000-0000-000000000001",
+			DocumentName: "one",
+			Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+
+		Expect(db.PostUser(context.Background(), database.User{
+			UUID:     "00000000-0000-0000-0000-000000000002",
+			Email:    strPoint("unagreed@example.com"),
+			Username: strPoint("unagreed@example.com"),
+		})).To(Succeed())
+	})
+
+	It("should list users who have not agreed to the current version", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/outstanding")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := GetOutstandingUsersHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"user_uuid": "00000000-0000-0000-0000-000000000002",
+				"user_email": "unagreed@example.com",
+				"username": "unagreed@example.com"
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
+	})
+
+	It("should list users as CSV", func() {
+		req := httptest.NewRequest(echo.GET, "/?format=csv", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/outstanding")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := GetOutstandingUsersHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body.String()).To(Equal(
+			"user_uuid,user_email,username\n" +
+				"00000000-0000-0000-0000-000000000002,unagreed@example.com,unagreed@example.com\n",
+		))
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal("text/csv; charset=UTF-8"))
+	})
+
+	DescribeTable("should pick the format from the Accept header",
+		func(accept string, contentType string) {
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			req.Header.Set(echo.HeaderAccept, accept)
+			res := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, res)
+			ctx.SetPath("/documents/:name/outstanding")
+			ctx.SetParamNames("name")
+			ctx.SetParamValues("one")
+
+			handler := GetOutstandingUsersHandler(db)
+			Expect(handler(ctx)).To(Succeed())
+			Expect(res.Header().Get("Content-Type")).To(Equal(contentType))
+		},
+		Entry("CSV", "text/csv", "text/csv; charset=UTF-8"),
+		Entry("CSV preferred", "application/json;q=0.5, text/csv", "text/csv; charset=UTF-8"),
+		Entry("CSV refused", "application/json, text/csv;q=0", echo.MIMEApplicationJSONCharsetUTF8),
+		Entry("anything", "*/*", echo.MIMEApplicationJSONCharsetUTF8),
+	)
+
+	It("should return a 406 when neither JSON nor CSV is acceptable", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		req.Header.Set(echo.HeaderAccept, "text/plain")
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/outstanding")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := GetOutstandingUsersHandler(db)
+		err := handler(ctx)
+		Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusNotAcceptable))
+	})
+
+	It("should stop values being read as formulas in the CSV", func() {
+		Expect(db.PostUser(context.Background(), database.User{
+			UUID:     "00000000-0000-0000-0000-000000000003",
+			Email:    strPoint("=cmd|' /C calc'!A0@example.com"),
+			Username: strPoint("@SUM(1+1)"),
+		})).To(Succeed())
+
+		req := httptest.NewRequest(echo.GET, "/?format=csv", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/outstanding")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := GetOutstandingUsersHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body.String()).To(ContainSubstring(
+			"00000000-0000-0000-0000-000000000003,'=cmd|' /c calc'!a0@example.com,'@SUM(1+1)\n",
+		))
+	})
+
+	It("should return a 404 for a document that doesn't exist", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name/outstanding")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("two")
+
+		handler := GetOutstandingUsersHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+})
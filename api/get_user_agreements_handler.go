@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+func GetUserAgreementsHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userUUID := c.Param("uuid")
+		if _, err := uuid.FromString(userUUID); err != nil {
+			return BadRequestError{fmt.Sprintf("bad uuid: %s", userUUID)}
+		}
+
+		from, err := parseTimeParam(c, "from")
+		if err != nil {
+			return err
+		}
+
+		to, err := parseTimeParam(c, "to")
+		if err != nil {
+			return err
+		}
+
+		limit, offset, err := parsePagination(c)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.GetUser(c.Request().Context(), userUUID)
+		if err != nil {
+			if err == database.ErrUserNotFound {
+				return userNotFoundError
+			}
+			return InternalServerError{err}
+		}
+
+		agreements, err := db.FilterAgreementsForUserUUID(c.Request().Context(), userUUID, database.AgreementFilter{
+			DocumentName: c.QueryParam("document_name"),
+			From:         from,
+			To:           to,
+			Limit:        limit,
+			Offset:       offset,
+		})
+		if err != nil {
+			return InternalServerError{err}
+		}
+
+		return c.JSON(http.StatusOK, agreements)
+	}
+}
@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetUserAgreementsHandler", func() {
+	var (
+		db                       *database.MemoryStore
+		user                     database.User
+		documentOne, documentTwo database.Document
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		user = database.User{
+			UUID:     "00000000-0000-0000-0000-000000000001",
+			Username: strPoint("example@example.com"),
+			Email:    strPoint("example@example.com"),
+		}
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
+
+		documentOne = database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		}
+		Expect(db.PutDocument(context.Background(), documentOne)).To(Succeed())
+
+		documentTwo = database.Document{
+			Name:      "document-two",
+			Content:   "content two",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		}
+		Expect(db.PutDocument(context.Background(), documentTwo)).To(Succeed())
+
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: documentOne.Name,
+			Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: documentTwo.Name,
+			Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: documentOne.Name,
+			Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	It("should get all agreements", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/agreements")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(user.UUID)
+
+		handler := GetUserAgreementsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-one",
+				"date": "2002-02-02T02:02:02Z",
+				"document_content_hash": "cdaf242e2e139dd255fbb56a691a9d0943a916a3235ee8d3cd73810d9d0b1ea2"
+			},
+			{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-two",
+				"date": "2003-03-03T03:03:03Z",
+				"document_content_hash": "c4f3079e433eaeb4e02b25c94b16b5ffa833a7c0d1f7733a41a73080d10a4f1b"
+			},
+			{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-one",
+				"date": "2004-04-04T04:04:04Z",
+				"document_content_hash": "cdaf242e2e139dd255fbb56a691a9d0943a916a3235ee8d3cd73810d9d0b1ea2"
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
+	})
+
+	It("should filter agreements by document name, date range and page", func() {
+		q := url.Values{
+			"document_name": []string{"document-one"},
+			"from":          []string{"2002-01-01T00:00:00Z"},
+			"to":            []string{"2005-01-01T00:00:00Z"},
+			"limit":         []string{"1"},
+			"offset":        []string{"1"},
+		}
+		req := httptest.NewRequest(echo.GET, "/?"+q.Encode(), nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/agreements")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(user.UUID)
+
+		handler := GetUserAgreementsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-one",
+				"date": "2004-04-04T04:04:04Z",
+				"document_content_hash": "cdaf242e2e139dd255fbb56a691a9d0943a916a3235ee8d3cd73810d9d0b1ea2"
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should reject a malformed date", func() {
+		q := url.Values{
+			"from": []string{"yesterday"},
+		}
+		req := httptest.NewRequest(echo.GET, "/?"+q.Encode(), nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/agreements")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(user.UUID)
+
+		handler := GetUserAgreementsHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+
+	It("should return a 404 for a user that doesn't exist", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/agreements")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues("00000000-0000-0000-0000-000000000005")
+
+		handler := GetUserAgreementsHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+})
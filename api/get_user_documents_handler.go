@@ -7,17 +7,19 @@ import (
 	"github.com/labstack/echo"
 )
 
-func GetUserDocumentsHandler(db *database.DB) echo.HandlerFunc {
+func GetUserDocumentsHandler(db database.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		allDocuments, err := db.GetDocumentsForUserUUID(c.Param("uuid"))
+		allDocuments, err := db.GetDocumentsForUserUUID(c.Request().Context(), c.Param("uuid"))
 		if err != nil {
 			return InternalServerError{err}
 		}
 
+		// Upcoming documents can be agreed to in advance, but do not need
+		// agreement until they come into force
 		onlyUnagreed := c.QueryParam("agreed") == "false"
 		userDocuments := []database.UserDocument{}
 		for _, doc := range allDocuments {
-			if onlyUnagreed && doc.AgreementDate != nil {
+			if onlyUnagreed && (doc.AgreementDate != nil || doc.Upcoming) {
 				continue
 			}
 			userDocuments = append(userDocuments, doc)
@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -16,55 +17,42 @@ import (
 
 var _ = Describe("GetUserDocumentsHandler", func() {
 	var (
-		db                       *database.DB
-		tempDB                   *database.TempDB
+		db                       *database.MemoryStore
 		user                     database.User
 		documentOne, documentTwo database.Document
 		agreement                database.Agreement
 	)
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
+		db = database.NewMemoryStore()
 
 		user = database.User{
 			UUID:     "00000000-0000-0000-0000-000000000001",
 			Username: strPoint("example@example.com"),
 			Email:    strPoint("example@example.com"),
 		}
-		Expect(db.PostUser(user)).To(Succeed())
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
 
 		documentOne = database.Document{
 			Name:      "document-one",
 			Content:   "content one",
 			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
 		}
-		Expect(db.PutDocument(documentOne)).To(Succeed())
+		Expect(db.PutDocument(context.Background(), documentOne)).To(Succeed())
 
 		documentTwo = database.Document{
 			Name:      "document-two",
 			Content:   "content two",
 			ValidFrom: time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
 		}
-		Expect(db.PutDocument(documentTwo)).To(Succeed())
+		Expect(db.PutDocument(context.Background(), documentTwo)).To(Succeed())
 
 		agreement = database.Agreement{
 			UserUUID:     user.UUID,
 			DocumentName: documentOne.Name,
 			Date:         documentOne.ValidFrom,
 		}
-		Expect(db.PutAgreement(agreement)).To(Succeed())
-	})
-
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
+		Expect(db.PutAgreement(context.Background(), agreement)).To(Succeed())
 	})
 
 	It("should get all documents", func() {
@@ -83,12 +71,14 @@ var _ = Describe("GetUserDocumentsHandler", func() {
 				"name": "document-one",
 				"content": "content one",
 				"valid_from": "` + documentOne.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
 				"agreement_date": "` + agreement.Date.Format(time.RFC3339) + `"
 			},
 			{
 				"name": "document-two",
 				"content": "content two",
 				"valid_from": "` + documentTwo.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
 				"agreement_date": null
 			}
 		]`))
@@ -115,6 +105,7 @@ var _ = Describe("GetUserDocumentsHandler", func() {
 				"name": "document-two",
 				"content": "content two",
 				"valid_from": "` + documentTwo.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
 				"agreement_date": null
 			}
 		]`))
@@ -122,6 +113,77 @@ var _ = Describe("GetUserDocumentsHandler", func() {
 		Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
 	})
 
+	It("should not require agreement to upcoming documents", func() {
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "document-three",
+			Content:   "content three",
+			ValidFrom: time.Now().Add(24 * time.Hour),
+		})).To(Succeed())
+
+		q := url.Values{
+			"agreed": []string{"false"},
+		}
+		req := httptest.NewRequest(echo.GET, "/?"+q.Encode(), nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/documents")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(user.UUID)
+
+		handler := GetUserDocumentsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"name": "document-two",
+				"content": "content two",
+				"valid_from": "` + documentTwo.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
+				"agreement_date": null
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should treat revoked agreements as unagreed", func() {
+		Expect(db.PutRevocation(context.Background(), database.Revocation{
+			UserUUID:     user.UUID,
+			DocumentName: documentOne.Name,
+			Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+		})).To(Succeed())
+
+		q := url.Values{
+			"agreed": []string{"false"},
+		}
+		req := httptest.NewRequest(echo.GET, "/?"+q.Encode(), nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/documents")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(user.UUID)
+
+		handler := GetUserDocumentsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"name": "document-one",
+				"content": "content one",
+				"valid_from": "` + documentOne.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
+				"agreement_date": null
+			},
+			{
+				"name": "document-two",
+				"content": "content two",
+				"valid_from": "` + documentTwo.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
+				"agreement_date": null
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+	})
+
 	It("should return unagreed documents when user does not exist", func() {
 		unknownUserUUID := "00000000-0000-0000-0000-000000000005"
 
@@ -140,12 +202,14 @@ var _ = Describe("GetUserDocumentsHandler", func() {
 				"name": "document-one",
 				"content": "content one",
 				"valid_from": "` + documentOne.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
 				"agreement_date": null
 			},
 			{
 				"name": "document-two",
 				"content": "content two",
 				"valid_from": "` + documentTwo.ValidFrom.Format(time.RFC3339) + `",
+				"upcoming": false,
 				"agreement_date": null
 			}
 		]`))
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+const MIMEApplicationZip = "application/zip"
+
+// userExport is everything held about a user, as returned to answer a
+// subject access request.
+type userExport struct {
+	ExportedAt  time.Time             `json:"exported_at"`
+	User        database.User         `json:"user"`
+	Agreements  []agreementExport     `json:"agreements"`
+	Revocations []database.Revocation `json:"revocations"`
+	Erasure     *database.Erasure     `json:"erasure"`
+}
+
+// agreementExport is an agreement along with the version of the document
+// that was agreed to.
+type agreementExport struct {
+	database.Agreement
+	Document database.Document `json:"document"`
+}
+
+// GetUserExportHandler returns everything held about a user as a JSON
+// document or, when requested with ?format=zip, as a zip archive containing
+// one JSON file per section.
+func GetUserExportHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userUUID := c.Param("uuid")
+		if _, err := uuid.FromString(userUUID); err != nil {
+			return BadRequestError{fmt.Sprintf("bad uuid: %s", userUUID)}
+		}
+
+		export, err := exportUser(c.Request().Context(), db, userUUID)
+		if err != nil {
+			if err == database.ErrUserNotFound {
+				return userNotFoundError
+			}
+			return InternalServerError{err}
+		}
+
+		if c.QueryParam("format") == "zip" {
+			c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.zip"`, userUUID))
+			return writeUserExportZip(c, export)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.json"`, userUUID))
+		return c.JSON(http.StatusOK, export)
+	}
+}
+
+func exportUser(ctx context.Context, db database.Store, userUUID string) (userExport, error) {
+	export := userExport{ExportedAt: time.Now().UTC()}
+
+	var err error
+	export.User, err = db.GetUser(ctx, userUUID)
+	if err != nil {
+		return export, err
+	}
+
+	agreements, err := db.GetAgreementsForUserUUID(ctx, userUUID)
+	if err != nil {
+		return export, err
+	}
+	export.Agreements = []agreementExport{}
+	for _, agreement := range agreements {
+		document, err := agreedDocument(ctx, db, agreement)
+		if err != nil {
+			return export, err
+		}
+		export.Agreements = append(export.Agreements, agreementExport{
+			Agreement: agreement,
+			Document:  document,
+		})
+	}
+
+	export.Revocations, err = db.GetRevocationsForUserUUID(ctx, userUUID)
+	if err != nil {
+		return export, err
+	}
+
+	export.Erasure, err = db.GetErasure(ctx, userUUID)
+	if err != nil {
+		return export, err
+	}
+
+	return export, nil
+}
+
+// agreedDocument returns the version of the document an agreement was made
+// to. Agreements made before the version was recorded are to the version in
+// force when the agreement was made.
+func agreedDocument(ctx context.Context, db database.Store, agreement database.Agreement) (database.Document, error) {
+	at := agreement.Date
+	if agreement.DocumentValidFrom != nil {
+		at = *agreement.DocumentValidFrom
+	}
+
+	version, err := db.GetDocumentVersionAt(ctx, agreement.DocumentName, at)
+	if err != nil {
+		return database.Document{}, err
+	}
+
+	return database.Document{
+		Name:      version.Name,
+		Content:   version.Content,
+		ValidFrom: version.ValidFrom,
+	}, nil
+}
+
+// writeUserExportZip builds the archive before sending any of it, so that an
+// error can still be returned as an error response.
+func writeUserExportZip(c echo.Context, export userExport) error {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"user.json", export.User},
+		{"agreements.json", export.Agreements},
+		{"revocations.json", export.Revocations},
+		{"erasure.json", export.Erasure},
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return InternalServerError{err}
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.content); err != nil {
+			return InternalServerError{err}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return InternalServerError{err}
+	}
+
+	return c.Blob(http.StatusOK, MIMEApplicationZip, buf.Bytes())
+}
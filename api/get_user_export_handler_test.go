@@ -0,0 +1,152 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetUserExportHandler", func() {
+	var (
+		db   *database.MemoryStore
+		user database.User
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		for _, document := range []database.Document{
+			{Name: "document-one", Content: "first content", ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)},
+			{Name: "document-one", Content: "second content", ValidFrom: time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC)},
+		} {
+			Expect(db.PutDocument(context.Background(), document)).To(Succeed())
+		}
+
+		user = database.User{
+			UUID:     "00000000-0000-0000-0000-000000000001",
+			Username: strPoint("example@example.com"),
+			Email:    strPoint("example@example.com"),
+		}
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
+
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutRevocation(context.Background(), database.Revocation{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	getExport := func(userUUID string, format string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(echo.GET, "/?format="+format, nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/export")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(userUUID)
+
+		handler := GetUserExportHandler(db)
+		return res, handler(ctx)
+	}
+
+	It("should export everything held about the user as JSON", func() {
+		res, err := getExport(user.UUID, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get(echo.HeaderContentDisposition)).To(Equal(`attachment; filename="` + user.UUID + `.json"`))
+
+		var export map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &export)).To(Succeed())
+		delete(export, "exported_at")
+
+		body, err := json.Marshal(export)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(MatchJSON(`{
+			"user": {
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"user_email": "example@example.com",
+				"username": "example@example.com"
+			},
+			"agreements": [{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-one",
+				"date": "2002-02-02T02:02:02Z",
+				"document_content_hash": "2cd4837c7726f70047c8fdafb52801dbfef2cb4f7bc4cfb2e0441980f9d4a3b8",
+				"document": {
+					"name": "document-one",
+					"content": "first content",
+					"valid_from": "2001-01-01T01:01:01Z"
+				}
+			}],
+			"revocations": [{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-one",
+				"date": "2004-04-04T04:04:04Z"
+			}],
+			"erasure": null
+		}`))
+	})
+
+	It("should export everything held about the user as a zip archive", func() {
+		res, err := getExport(user.UUID, "zip")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get(echo.HeaderContentType)).To(Equal(MIMEApplicationZip))
+
+		archive, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+		Expect(err).ToNot(HaveOccurred())
+
+		files := map[string]string{}
+		for _, file := range archive.File {
+			r, err := file.Open()
+			Expect(err).ToNot(HaveOccurred())
+			content, err := io.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			files[file.Name] = string(content)
+		}
+
+		Expect(files).To(HaveKey("user.json"))
+		Expect(files).To(HaveKey("agreements.json"))
+		Expect(files).To(HaveKey("revocations.json"))
+		Expect(files).To(HaveKey("erasure.json"))
+		Expect(files["agreements.json"]).To(ContainSubstring("first content"))
+	})
+
+	It("should include the erasure of an erased user", func() {
+		_, err := db.EraseUser(context.Background(), user.UUID, strPoint("jeff"))
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := getExport(user.UUID, "")
+		Expect(err).ToNot(HaveOccurred())
+
+		var export struct {
+			User    database.User     `json:"user"`
+			Erasure *database.Erasure `json:"erasure"`
+		}
+		Expect(json.Unmarshal(res.Body.Bytes(), &export)).To(Succeed())
+		Expect(export.User.Email).To(BeNil())
+		Expect(export.Erasure).ToNot(BeNil())
+		Expect(export.Erasure.Principal).To(Equal(strPoint("jeff")))
+	})
+
+	It("should return a 404 when the user doesn't exist", func() {
+		_, err := getExport("00000000-0000-0000-0000-000000000002", "")
+		Expect(err).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+})
@@ -7,9 +7,9 @@ import (
 	"github.com/labstack/echo"
 )
 
-func GetUserHandler(db *database.DB) echo.HandlerFunc {
+func GetUserHandler(db database.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		user, err := db.GetUser(c.Param("uuid"))
+		user, err := db.GetUser(c.Request().Context(), c.Param("uuid"))
 		if err != nil {
 			if err == database.ErrUserNotFound {
 				return NotFoundError{"user not found"}
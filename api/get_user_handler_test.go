@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 
@@ -14,32 +15,19 @@ import (
 
 var _ = Describe("GetUserHandler", func() {
 	var (
-		db     *database.DB
-		tempDB *database.TempDB
-		user   database.User
+		db   *database.MemoryStore
+		user database.User
 	)
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
+		db = database.NewMemoryStore()
 
 		user = database.User{
 			UUID:     "00000000-0000-0000-0000-000000000001",
 			Email:    strPoint("example@example.com"),
 			Username: strPoint("example@example.com"),
 		}
-		Expect(db.PostUser(user)).To(Succeed())
-	})
-
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
 	})
 
 	It("should get a user", func() {
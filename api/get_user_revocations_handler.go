@@ -0,0 +1,34 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+func GetUserRevocationsHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userUUID := c.Param("uuid")
+		if _, err := uuid.FromString(userUUID); err != nil {
+			return BadRequestError{fmt.Sprintf("bad uuid: %s", userUUID)}
+		}
+
+		_, err := db.GetUser(c.Request().Context(), userUUID)
+		if err != nil {
+			if err == database.ErrUserNotFound {
+				return userNotFoundError
+			}
+			return InternalServerError{err}
+		}
+
+		revocations, err := db.GetRevocationsForUserUUID(c.Request().Context(), userUUID)
+		if err != nil {
+			return InternalServerError{err}
+		}
+
+		return c.JSON(http.StatusOK, revocations)
+	}
+}
@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("GetUserRevocationsHandler", func() {
+	var (
+		db   *database.MemoryStore
+		user database.User
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+
+		user = database.User{
+			UUID:     "00000000-0000-0000-0000-000000000001",
+			Username: strPoint("example@example.com"),
+			Email:    strPoint("example@example.com"),
+		}
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
+
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+		Expect(db.PutRevocation(context.Background(), database.Revocation{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+		})).To(Succeed())
+	})
+
+	getRevocations := func(userUUID string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/users/:uuid/revocations")
+		ctx.SetParamNames("uuid")
+		ctx.SetParamValues(userUUID)
+
+		handler := GetUserRevocationsHandler(db)
+		return res, handler(ctx)
+	}
+
+	It("should get the revocations of a user", func() {
+		res, err := getRevocations(user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Body).To(MatchJSON(`[
+			{
+				"user_uuid": "00000000-0000-0000-0000-000000000001",
+				"document_name": "document-one",
+				"date": "2003-03-03T03:03:03Z"
+			}
+		]`))
+		Expect(res.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should return a 404 when the user doesn't exist", func() {
+		_, err := getRevocations("00000000-0000-0000-0000-000000000002")
+		Expect(err).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+
+	It("should return a 400 when the uuid is not valid", func() {
+		_, err := getRevocations("00000000-0000-0000-0000")
+		Expect(err).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+})
@@ -10,7 +10,7 @@ import (
 	"github.com/labstack/echo"
 )
 
-func GetUsersHandler(db *database.DB) echo.HandlerFunc {
+func GetUsersHandler(db database.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		type Users struct {
 			Users []*database.User `json:"users"`
@@ -30,7 +30,7 @@ func GetUsersHandler(db *database.DB) echo.HandlerFunc {
 				}
 			}
 
-			results, err := db.GetUsersByUUID(strings.Split(params["uuids"][0], ","))
+			results, err := db.GetUsersByUUID(c.Request().Context(), strings.Split(params["uuids"][0], ","))
 
 			if err != nil {
 				return InternalServerError{err}
@@ -41,7 +41,7 @@ func GetUsersHandler(db *database.DB) echo.HandlerFunc {
 
 		email := params.Get("email")
 		if email != "" {
-			dbUsers, err := db.GetUserByEmail(email)
+			dbUsers, err := db.GetUserByEmail(c.Request().Context(), email)
 			if err != nil {
 
 				if err == database.ErrUserNotFound {
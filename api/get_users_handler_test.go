@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,47 +16,34 @@ import (
 
 var _ = Describe("GetUsersHandler", func() {
 	var (
-		db     *database.DB
-		tempDB *database.TempDB
-		user1  database.User
-		user2  database.User
-		user3  database.User
+		db    *database.MemoryStore
+		user1 database.User
+		user2 database.User
+		user3 database.User
 	)
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
+		db = database.NewMemoryStore()
 
 		user1 = database.User{
 			UUID:     "00000000-0000-0000-0000-000000000001",
 			Email:    strPoint("example1@example.com"),
 			Username: strPoint("example1@example.com"),
 		}
-		Expect(db.PostUser(user1)).To(Succeed())
+		Expect(db.PostUser(context.Background(), user1)).To(Succeed())
 		user2 = database.User{
 			UUID:     "00000000-0000-0000-0000-000000000002",
 			Email:    strPoint("example2@example.com"),
 			Username: strPoint("example2@example.com"),
 		}
-		Expect(db.PostUser(user2)).To(Succeed())
+		Expect(db.PostUser(context.Background(), user2)).To(Succeed())
 		user3 = database.User{
 			UUID:     "00000000-0000-0000-0000-000000000003",
 			Email:    strPoint("example3@example.com"),
 			Username: strPoint("example3@example.com"),
 		}
-		Expect(db.PostUser(user3)).To(Succeed())
-
-	})
+		Expect(db.PostUser(context.Background(), user3)).To(Succeed())
 
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
 	})
 
 	It("should get users by uuids", func() {
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+)
+
+// serverState is the state of a Server shared between its handlers and
+// ListenAndServe.
+type serverState struct {
+	drainDelay time.Duration
+
+	mu       sync.Mutex
+	draining bool
+}
+
+func (state *serverState) setDraining() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.draining = true
+}
+
+func (state *serverState) isDraining() bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.draining
+}
+
+type checkResult struct {
+	OK         bool    `json:"ok"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type readinessBody struct {
+	OK     bool                   `json:"ok"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// HealthzHandler reports that the process is alive. It checks nothing else,
+// so that an instance is only restarted when it cannot serve at all.
+func HealthzHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]bool{
+		"ok": true,
+	})
+}
+
+// migratedStore is a store whose schema is versioned by migrations, like
+// database.DB.
+type migratedStore interface {
+	MigrationVersion(ctx context.Context) (uint, bool, error)
+}
+
+// ReadyzHandler reports whether the instance should be sent requests: the
+// database can be reached, it has been migrated to the version this build
+// expects, and the server is not draining. Stores without migrations skip the
+// migrations check.
+func ReadyzHandler(db database.Store, draining func() bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		checks := map[string]func() error{
+			"database": func() error {
+				return db.Ping(ctx)
+			},
+			"draining": func() error {
+				if draining() {
+					return fmt.Errorf("the server is shutting down")
+				}
+				return nil
+			},
+		}
+		if migrated, ok := db.(migratedStore); ok {
+			checks["migrations"] = func() error {
+				return checkMigrations(ctx, migrated)
+			}
+		}
+
+		body := readinessBody{OK: true, Checks: map[string]checkResult{}}
+		for name, check := range checks {
+			start := time.Now()
+			err := check()
+			result := checkResult{
+				OK:         err == nil,
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Error = err.Error()
+				body.OK = false
+			}
+			body.Checks[name] = result
+		}
+
+		if !body.OK {
+			return c.JSON(http.StatusServiceUnavailable, body)
+		}
+		return c.JSON(http.StatusOK, body)
+	}
+}
+
+func checkMigrations(ctx context.Context, db migratedStore) error {
+	expected, err := database.LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := db.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed part way through", version)
+	}
+	// A newer version is fine: migrations are applied before the code that
+	// needs them is deployed, so must keep working with the previous build.
+	if version < expected {
+		return fmt.Errorf("at version %d, expected %d", version, expected)
+	}
+
+	return nil
+}
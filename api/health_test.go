@@ -0,0 +1,139 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("Health checks", func() {
+	It("should report the process is alive without authentication", func() {
+		server := NewServer(Config{
+			BasicAuthUsername: "jeff",
+			BasicAuthPassword: "jefferson",
+			LogWriter:         GinkgoWriter,
+		})
+
+		req := httptest.NewRequest(echo.GET, "/healthz", nil)
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(MatchJSON(`{"ok": true}`))
+	})
+
+	It("should be ready with a store that has no migrations", func() {
+		server := NewServer(Config{
+			DB:                database.NewMemoryStore(),
+			BasicAuthUsername: "jeff",
+			BasicAuthPassword: "jefferson",
+			LogWriter:         GinkgoWriter,
+		})
+
+		req := httptest.NewRequest(echo.GET, "/readyz", nil)
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		var body map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &body)).To(Succeed())
+		Expect(body["checks"]).To(HaveKeyWithValue("database", HaveKeyWithValue("ok", true)))
+		Expect(body["checks"]).ToNot(HaveKey("migrations"))
+	})
+
+	Describe("readiness", func() {
+		var (
+			db     *database.DB
+			tempDB *database.TempDB
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDB, err = database.NewTempDB()
+			Expect(err).ToNot(HaveOccurred())
+
+			db, err = database.NewDB(tempDB.TempConnectionString)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			db.Close()
+			Expect(tempDB.Close()).To(Succeed())
+		})
+
+		readyz := func(server *Server) (int, map[string]interface{}) {
+			req := httptest.NewRequest(echo.GET, "/readyz", nil)
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+
+			var body map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &body)).To(Succeed())
+			return res.Code, body
+		}
+
+		It("should be ready once the database is migrated", func() {
+			Expect(db.Init()).To(Succeed())
+			server := NewServer(Config{DB: db, BasicAuthUsername: "jeff", BasicAuthPassword: "jefferson", LogWriter: GinkgoWriter})
+
+			code, body := readyz(server)
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body).To(HaveKeyWithValue("ok", true))
+			Expect(body["checks"]).To(HaveKeyWithValue("database", HaveKeyWithValue("ok", true)))
+			Expect(body["checks"]).To(HaveKeyWithValue("migrations", HaveKeyWithValue("ok", true)))
+			Expect(body["checks"]).To(HaveKeyWithValue("draining", HaveKeyWithValue("ok", true)))
+		})
+
+		It("should not be ready before the database is migrated", func() {
+			server := NewServer(Config{DB: db, BasicAuthUsername: "jeff", BasicAuthPassword: "jefferson", LogWriter: GinkgoWriter})
+
+			code, body := readyz(server)
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(body["checks"]).To(HaveKeyWithValue("migrations", HaveKeyWithValue("ok", false)))
+		})
+
+		It("should not be ready while draining", func() {
+			Expect(db.Init()).To(Succeed())
+			server := NewServer(Config{
+				DB:                db,
+				BasicAuthUsername: "jeff",
+				BasicAuthPassword: "jefferson",
+				DrainDelay:        time.Second,
+				LogWriter:         GinkgoWriter,
+			})
+
+			ctx, shutdownServer := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(ListenAndServe(ctx, server, "127.0.0.1:0")).To(Succeed())
+				close(stopped)
+			}()
+			Eventually(func() net.Listener {
+				return server.Listener
+			}).ShouldNot(BeNil())
+			url := "http://" + server.Listener.Addr().String() + "/readyz"
+
+			res, err := http.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+			shutdownServer()
+			Eventually(func() int {
+				res, err := http.Get(url)
+				Expect(err).ToNot(HaveOccurred())
+				return res.StatusCode
+			}).Should(Equal(http.StatusServiceUnavailable))
+
+			Eventually(stopped, 10*time.Second).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// requestID returns the ID of the request, taken from its X-Request-Id
+// header or else generated by the RequestID middleware.
+func requestID(c echo.Context) string {
+	return c.Response().Header().Get(echo.HeaderXRequestID)
+}
+
+// accessLog logs one JSON line for each request once it has been handled.
+func accessLog() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			entry := log.JSON{
+				"message":     "request",
+				"request_id":  requestID(c),
+				"method":      c.Request().Method,
+				"route":       c.Path(),
+				"status":      c.Response().Status,
+				"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+				"bytes_out":   c.Response().Size,
+			}
+			if client, ok := c.Get(ClientContextKey).(Client); ok {
+				entry["client"] = client.Name
+				if client.UserUUID != "" {
+					entry["user"] = client.UserUUID
+				}
+			}
+			if secretID, ok := c.Get(secretContextKey).(string); ok {
+				entry["secret"] = secretID
+			}
+			c.Logger().Infoj(entry)
+
+			return nil
+		}
+	}
+}
+
+// logError logs an error along with the ID of the request it happened in.
+func logError(c echo.Context, err error) {
+	c.Logger().Errorj(log.JSON{
+		"message":    err.Error(),
+		"request_id": requestID(c),
+	})
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+)
+
+var _ = Describe("Request logging", func() {
+	var (
+		logs   bytes.Buffer
+		server *Server
+	)
+
+	BeforeEach(func() {
+		logs.Reset()
+		server = NewServer(Config{
+			BasicAuthUsername: "jeff",
+			BasicAuthPassword: "jefferson",
+			LogWriter:         &logs,
+		})
+	})
+
+	logLines := func() []map[string]interface{} {
+		lines := []map[string]interface{}{}
+		scanner := bufio.NewScanner(bytes.NewReader(logs.Bytes()))
+		for scanner.Scan() {
+			var line map[string]interface{}
+			Expect(json.Unmarshal(scanner.Bytes(), &line)).To(Succeed())
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	It("should log each request with its route, status and client", func() {
+		req := httptest.NewRequest(echo.DELETE, "/users/not-a-uuid", nil)
+		req.SetBasicAuth("jeff", "jefferson")
+		req.Header.Set(echo.HeaderXRequestID, "support-ticket-123")
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+
+		Expect(res.Code).To(Equal(http.StatusBadRequest))
+		Expect(res.Header().Get(echo.HeaderXRequestID)).To(Equal("support-ticket-123"))
+		Expect(res.Body.String()).To(MatchJSON(`{
+			"message": "bad uuid: not-a-uuid",
+			"request_id": "support-ticket-123"
+		}`))
+
+		lines := logLines()
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(HaveKeyWithValue("level", "ERROR"))
+		Expect(lines[0]).To(HaveKeyWithValue("message", "bad uuid: not-a-uuid"))
+		Expect(lines[0]).To(HaveKeyWithValue("request_id", "support-ticket-123"))
+		Expect(lines[1]).To(HaveKeyWithValue("message", "request"))
+		Expect(lines[1]).To(HaveKeyWithValue("request_id", "support-ticket-123"))
+		Expect(lines[1]).To(HaveKeyWithValue("method", "DELETE"))
+		Expect(lines[1]).To(HaveKeyWithValue("route", "/users/:uuid"))
+		Expect(lines[1]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusBadRequest)))
+		Expect(lines[1]).To(HaveKeyWithValue("client", "jeff"))
+		Expect(lines[1]).To(HaveKeyWithValue("secret", "current"))
+		Expect(lines[1]).To(HaveKey("duration_ms"))
+	})
+
+	It("should generate a request id when there is none", func() {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+
+		Expect(res.Code).To(Equal(http.StatusOK))
+		id := res.Header().Get(echo.HeaderXRequestID)
+		Expect(id).ToNot(BeEmpty())
+
+		lines := logLines()
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(HaveKeyWithValue("request_id", id))
+		Expect(lines[0]).ToNot(HaveKey("client"))
+	})
+})
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// collectedStore is a store that exports its own metrics, like database.DB.
+type collectedStore interface {
+	Collectors() []prometheus.Collector
+}
+
+func newRegistry(config Config) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db, ok := config.DB.(collectedStore); ok {
+		registry.MustRegister(db.Collectors()...)
+	}
+	return registry
+}
+
+func metricsHandler(registry *prometheus.Registry) echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// instrument records the duration of each request by route and status.
+func instrument(registry *prometheus.Registry) echo.MiddlewareFunc {
+	requestDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "paas_accounts_http_request_duration_seconds",
+		Help:    "Time taken to handle each request.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	registry.MustRegister(requestDuration)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			requestDuration.WithLabelValues(
+				c.Request().Method,
+				c.Path(),
+				strconv.Itoa(c.Response().Status),
+			).Observe(time.Since(start).Seconds())
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+
+	. "github.com/alphagov/paas-accounts/api"
+)
+
+var _ = Describe("Metrics", func() {
+	var server *Server
+
+	BeforeEach(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("prometheus-secret"), bcrypt.MinCost)
+		Expect(err).ToNot(HaveOccurred())
+
+		server = NewServer(Config{
+			Clients: []Client{{
+				Name:    "prometheus",
+				Secrets: []Secret{{ID: "1", Hash: string(hash)}},
+				Scopes:  []string{ScopeMetricsRead},
+			}},
+			LogWriter: GinkgoWriter,
+		})
+	})
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, path, nil)
+		req.SetBasicAuth("prometheus", "prometheus-secret")
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		return res
+	}
+
+	It("should expose request durations by route and status", func() {
+		Expect(request("/users/not-a-uuid").Code).To(Equal(http.StatusForbidden))
+
+		res := request("/metrics")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring(`paas_accounts_http_request_duration_seconds_count{method="GET",route="/users/:uuid",status="403"} 1`))
+		Expect(res.Body.String()).To(ContainSubstring(`go_goroutines`))
+	})
+
+	It("should require the metrics:read scope", func() {
+		req := httptest.NewRequest(echo.GET, "/metrics", nil)
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, req)
+		Expect(res.Code).To(Equal(http.StatusUnauthorized))
+	})
+})
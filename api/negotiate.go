@@ -0,0 +1,67 @@
+package api
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// negotiate picks the media type to respond with from those offered, by
+// the quality the Accept header gives each. Ties go to the earlier offer,
+// as does a request without an Accept header. It returns an empty string if
+// the client accepts none of them.
+func negotiate(c echo.Context, offers ...string) string {
+	c.Response().Header().Add(echo.HeaderVary, "Accept")
+
+	accept := c.Request().Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if quality := acceptQuality(accept, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality given to a media type by the most
+// specific range in an Accept header that matches it.
+func acceptQuality(accept, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		acceptedType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case acceptedType == mediaType:
+			s = 2
+		case strings.HasSuffix(acceptedType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(acceptedType, "*")):
+			s = 1
+		case acceptedType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
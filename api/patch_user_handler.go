@@ -15,12 +15,12 @@ type PatchRequest struct {
 
 var userNotFoundError = NotFoundError{"user not found"}
 
-func PatchUserHandler(db *database.DB) echo.HandlerFunc {
+func PatchUserHandler(db database.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var payload PatchRequest
 		err := c.Bind(&payload)
 		if err != nil {
-			return InternalServerError{err}
+			return err
 		}
 
 		err = c.Validate(payload)
@@ -29,7 +29,7 @@ func PatchUserHandler(db *database.DB) echo.HandlerFunc {
 			return ValidationError{valerr}
 		}
 
-		user, err := db.GetUser(c.Param("uuid"))
+		user, err := db.GetUser(c.Request().Context(), c.Param("uuid"))
 		if err != nil {
 			if err == database.ErrUserNotFound {
 				return userNotFoundError
@@ -44,12 +44,12 @@ func PatchUserHandler(db *database.DB) echo.HandlerFunc {
 
 		user.Email = payload.Email
 
-		err = db.PatchUser(user)
+		err = db.PatchUser(c.Request().Context(), user)
 		if err != nil {
-			return InternalServerError{err}
+			return err
 		}
 
-		updateduser, err := db.GetUser(c.Param("uuid"))
+		updateduser, err := db.GetUser(c.Request().Context(), c.Param("uuid"))
 		if err != nil {
 			if err == database.ErrUserNotFound {
 				return userNotFoundError
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -15,39 +16,24 @@ import (
 )
 
 var _ = Describe("PatchUserHandler", func() {
-	var (
-		db     *database.DB
-		tempDB *database.TempDB
-	)
+	var db *database.MemoryStore
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
+		db = database.NewMemoryStore()
 
 		user := database.User{
 			UUID:     "00000000-0000-0000-0000-000000000001",
 			Email:    strPoint("example@example.com"),
 			Username: strPoint("example@example.com"),
 		}
-		Expect(db.PostUser(user)).To(Succeed())
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
 
 		user2 := database.User{
 			UUID:     "00000000-0000-0000-0000-000000000002",
 			Email:    strPoint("example2@example.com"),
 			Username: nil,
 		}
-		Expect(db.PostUser(user2)).To(Succeed())
-	})
-
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
+		Expect(db.PostUser(context.Background(), user2)).To(Succeed())
 	})
 
 	It("should update an existing user's email", func() {
@@ -82,7 +68,7 @@ var _ = Describe("PatchUserHandler", func() {
 
 		user.UUID = userUUID
 
-		userData, err := db.GetUser(user.UUID)
+		userData, err := db.GetUser(context.Background(), user.UUID)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(userData.UUID).To(Equal(userUUID))
 		Expect(userData.Email).To(Equal(user.Email))
@@ -120,7 +106,7 @@ var _ = Describe("PatchUserHandler", func() {
 
 		user.UUID = userUUID
 
-		userData, err := db.GetUser(user.UUID)
+		userData, err := db.GetUser(context.Background(), user.UUID)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(userData.UUID).To(Equal(userUUID))
 		Expect(userData.Email).To(Equal(user.Email))
@@ -159,7 +145,7 @@ var _ = Describe("PatchUserHandler", func() {
 
 		user.UUID = userUUID
 
-		userData, err := db.GetUser(user.UUID)
+		userData, err := db.GetUser(context.Background(), user.UUID)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(userData.UUID).To(Equal(userUUID))
 		Expect(userData.Email).To(Equal(user.Email))
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -8,31 +9,95 @@ import (
 	"github.com/labstack/echo"
 )
 
-func PostAgreementsHandler(db *database.DB) echo.HandlerFunc {
+// HeaderForwardedUserAgent carries the user agent of the end user when an
+// agreement is submitted on their behalf, for example by paas-admin.
+const HeaderForwardedUserAgent = "X-Forwarded-User-Agent"
+
+type agreementRequest struct {
+	UserUUID          string     `json:"user_uuid"`
+	DocumentName      string     `json:"document_name"`
+	DocumentValidFrom *time.Time `json:"document_valid_from"`
+	Channel           *string    `json:"channel"`
+}
+
+func PostAgreementsHandler(db database.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var agreement database.Agreement
-		err := c.Bind(&agreement)
+		var payload agreementRequest
+		err := c.Bind(&payload)
 		if err != nil {
-			return InternalServerError{err}
+			return err
 		}
 
-		_, err = db.GetUser(agreement.UserUUID)
+		err = requireSelf(c, ScopeAgreementsWrite, payload.UserUUID)
 		if err != nil {
-			err = db.PostUser(database.User{
-				UUID: agreement.UserUUID,
-			})
+			return err
+		}
 
-			if err != nil {
-				return InternalServerError{err}
-			}
+		document, err := agreementDocumentVersion(c.Request().Context(), db, payload)
+		if err == database.ErrDocumentNotFound {
+			return ErrDocumentNotFound
+		} else if err != nil {
+			return InternalServerError{err}
 		}
 
-		agreement.Date = time.Now()
-		err = db.PutAgreement(agreement)
+		agreement := database.Agreement{
+			UserUUID:            payload.UserUUID,
+			DocumentName:        payload.DocumentName,
+			Date:                time.Now(),
+			DocumentValidFrom:   &document.ValidFrom,
+			DocumentContentHash: strPoint(database.ContentHash(document.Content)),
+			Provenance:          requestProvenance(c, payload.Channel),
+		}
+		err = db.PutAgreementForUser(c.Request().Context(), agreement)
 		if err != nil {
-			return InternalServerError{err}
+			return err
 		}
 
 		return c.NoContent(http.StatusCreated)
 	}
 }
+
+// agreementDocumentVersion finds the version of the document being agreed
+// to: the version named by document_valid_from, or else the version
+// currently in force.
+func agreementDocumentVersion(ctx context.Context, db database.Store, payload agreementRequest) (database.Document, error) {
+	if payload.DocumentValidFrom == nil {
+		return db.GetDocument(ctx, payload.DocumentName)
+	}
+
+	version, err := db.GetDocumentVersionAt(ctx, payload.DocumentName, *payload.DocumentValidFrom)
+	if err != nil {
+		return database.Document{}, err
+	}
+	if !version.ValidFrom.Equal(*payload.DocumentValidFrom) {
+		return database.Document{}, database.ErrDocumentNotFound
+	}
+
+	return database.Document{
+		Name:      version.Name,
+		Content:   version.Content,
+		ValidFrom: version.ValidFrom,
+	}, nil
+}
+
+func requestProvenance(c echo.Context, channel *string) database.Provenance {
+	provenance := database.Provenance{
+		Principal: requestPrincipal(c),
+		Channel:   channel,
+		ClientIP:  strPoint(requestClientIP(c)),
+	}
+
+	userAgent := c.Request().Header.Get(HeaderForwardedUserAgent)
+	if userAgent == "" {
+		userAgent = c.Request().UserAgent()
+	}
+	if userAgent != "" {
+		provenance.UserAgent = &userAgent
+	}
+
+	return provenance
+}
+
+func strPoint(str string) *string {
+	return &str
+}
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,25 +17,10 @@ import (
 )
 
 var _ = Describe("PostAgreementsHandler", func() {
-	var (
-		db     *database.DB
-		tempDB *database.TempDB
-	)
+	var db *database.MemoryStore
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
-	})
-
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
+		db = database.NewMemoryStore()
 	})
 
 	It("should accept an agreement", func() {
@@ -43,14 +29,14 @@ var _ = Describe("PostAgreementsHandler", func() {
 			Content:   "content one",
 			ValidFrom: time.Now(),
 		}
-		Expect(db.PutDocument(document)).To(Succeed())
+		Expect(db.PutDocument(context.Background(), document)).To(Succeed())
 
 		user := database.User{
 			UUID:     "00000000-0000-0000-0000-000000000001",
 			Username: strPoint("example@example.com"),
 			Email:    strPoint("example@example.com"),
 		}
-		Expect(db.PostUser(user)).To(Succeed())
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
 
 		input := database.Agreement{
 			UserUUID:     user.UUID,
@@ -70,11 +56,106 @@ var _ = Describe("PostAgreementsHandler", func() {
 		Expect(res.Body.String()).To(BeEmpty())
 		Expect(res.Code).To(Equal(http.StatusCreated))
 
-		agreements, err := db.GetAgreementsForUserUUID(user.UUID)
+		agreements, err := db.GetAgreementsForUserUUID(context.Background(), user.UUID)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(agreements).To(HaveLen(1))
 		Expect(agreements[0].UserUUID).To(Equal(input.UserUUID))
 		Expect(agreements[0].DocumentName).To(Equal(input.DocumentName))
 		Expect(agreements[0].Date).To(BeTemporally("~", time.Now(), time.Minute))
 	})
+
+	It("should record the provenance of an agreement", func() {
+		document := database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		}
+		Expect(db.PutDocument(context.Background(), document)).To(Succeed())
+
+		buf := []byte(`{
+			"user_uuid": "00000000-0000-0000-0000-000000000001",
+			"document_name": "document-one",
+			"channel": "paas-admin"
+		}`)
+		req := httptest.NewRequest(echo.POST, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.1, 198.51.100.1")
+		req.Header.Set(HeaderForwardedUserAgent, "Mozilla/5.0")
+		req.Header.Set("User-Agent", "paas-admin")
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/agreements")
+		ctx.Set(ClientContextKey, Client{Name: "jeff"})
+
+		handler := PostAgreementsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Code).To(Equal(http.StatusCreated))
+
+		agreements, err := db.GetAgreementsForUserUUID(context.Background(), "00000000-0000-0000-0000-000000000001")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agreements).To(HaveLen(1))
+		Expect(*agreements[0].DocumentValidFrom).To(BeTemporally("==", document.ValidFrom))
+		Expect(agreements[0].DocumentContentHash).To(Equal(strPoint(database.ContentHash(document.Content))))
+		Expect(agreements[0].Principal).To(Equal(strPoint("jeff")))
+		Expect(agreements[0].Channel).To(Equal(strPoint("paas-admin")))
+		Expect(agreements[0].ClientIP).To(Equal(strPoint("198.51.100.1")))
+		Expect(agreements[0].UserAgent).To(Equal(strPoint("Mozilla/5.0")))
+	})
+
+	It("should return a 404 for a document that doesn't exist", func() {
+		input := database.Agreement{
+			UserUUID:     "00000000-0000-0000-0000-000000000001",
+			DocumentName: "document-one",
+		}
+
+		buf, err := json.Marshal(input)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(echo.POST, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/agreements")
+
+		handler := PostAgreementsHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+
+	It("should accept an agreement to an upcoming version of a document", func() {
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+		upcomingValidFrom := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "document-one",
+			Content:   "upcoming content",
+			ValidFrom: upcomingValidFrom,
+		})).To(Succeed())
+
+		input := database.Agreement{
+			UserUUID:          "00000000-0000-0000-0000-000000000001",
+			DocumentName:      "document-one",
+			DocumentValidFrom: &upcomingValidFrom,
+		}
+
+		buf, err := json.Marshal(input)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(echo.POST, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/agreements")
+
+		handler := PostAgreementsHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Code).To(Equal(http.StatusCreated))
+
+		agreements, err := db.GetAgreementsForUserUUID(context.Background(), input.UserUUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agreements).To(HaveLen(1))
+		Expect(agreements[0].DocumentValidFrom).ToNot(BeNil())
+		Expect(*agreements[0].DocumentValidFrom).To(BeTemporally("==", upcomingValidFrom))
+	})
 })
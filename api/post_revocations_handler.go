@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+var ErrAgreementNotFound = NotFoundError{"agreement not found"}
+
+func PostRevocationsHandler(db database.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var revocation database.Revocation
+		err := c.Bind(&revocation)
+		if err != nil {
+			return err
+		}
+
+		if _, err := uuid.FromString(revocation.UserUUID); err != nil {
+			return BadRequestError{fmt.Sprintf("bad uuid: %s", revocation.UserUUID)}
+		}
+
+		_, err = db.GetUser(c.Request().Context(), revocation.UserUUID)
+		if err != nil {
+			if err == database.ErrUserNotFound {
+				return userNotFoundError
+			}
+			return InternalServerError{err}
+		}
+
+		revocation.Date = time.Now()
+		err = db.PutRevocation(c.Request().Context(), revocation)
+		if err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusCreated)
+	}
+}
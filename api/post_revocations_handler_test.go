@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("PostRevocationsHandler", func() {
+	var (
+		db   *database.MemoryStore
+		user database.User
+	)
+
+	BeforeEach(func() {
+		db = database.NewMemoryStore()
+
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "document-one",
+			Content:   "content one",
+			ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+		})).To(Succeed())
+
+		user = database.User{
+			UUID:     "00000000-0000-0000-0000-000000000001",
+			Username: strPoint("example@example.com"),
+			Email:    strPoint("example@example.com"),
+		}
+		Expect(db.PostUser(context.Background(), user)).To(Succeed())
+	})
+
+	postRevocation := func(input database.Revocation) (*httptest.ResponseRecorder, error) {
+		buf, err := json.Marshal(input)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(echo.POST, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/agreements/revocations")
+
+		handler := PostRevocationsHandler(db)
+		return res, handler(ctx)
+	}
+
+	It("should accept a revocation", func() {
+		Expect(db.PutAgreement(context.Background(), database.Agreement{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+		})).To(Succeed())
+
+		res, err := postRevocation(database.Revocation{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+			Reason:       strPoint("withdrew consent"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Body.String()).To(BeEmpty())
+		Expect(res.Code).To(Equal(http.StatusCreated))
+
+		revocations, err := db.GetRevocationsForUserUUID(context.Background(), user.UUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(revocations).To(HaveLen(1))
+		Expect(revocations[0].DocumentName).To(Equal("document-one"))
+		Expect(revocations[0].Reason).To(Equal(strPoint("withdrew consent")))
+		Expect(revocations[0].Date).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should return a 404 when there is no agreement to revoke", func() {
+		_, err := postRevocation(database.Revocation{
+			UserUUID:     user.UUID,
+			DocumentName: "document-one",
+		})
+		Expect(err).To(MatchError(database.ErrAgreementNotFound))
+	})
+
+	It("should return a 400 when the user uuid is not valid", func() {
+		_, err := postRevocation(database.Revocation{
+			UserUUID:     "00000000-0000-0000-0000",
+			DocumentName: "document-one",
+		})
+		Expect(err).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+
+	It("should return a 404 when the user doesn't exist", func() {
+		_, err := postRevocation(database.Revocation{
+			UserUUID:     "00000000-0000-0000-0000-000000000002",
+			DocumentName: "document-one",
+		})
+		Expect(err).To(BeAssignableToTypeOf(NotFoundError{}))
+	})
+})
@@ -2,7 +2,9 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 
@@ -15,22 +17,12 @@ import (
 )
 
 var _ = Describe("PostUserHandler", func() {
-	var (
-		db     *database.DB
-		tempDB *database.TempDB
-	)
+	var db *database.MemoryStore
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
+		db = database.NewMemoryStore()
 
-		Expect(db.Init()).To(Succeed())
-
-		err = db.PostUser(database.User{
+		err := db.PostUser(context.Background(), database.User{
 			UUID:     "11111111-1111-1111-1111-111111111111",
 			Email:    strPoint("jeff@jefferson.com"),
 			Username: strPoint("jeff@jefferson.com"),
@@ -38,11 +30,6 @@ var _ = Describe("PostUserHandler", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
-	})
-
 	It("should add a new user", func() {
 		user := database.User{
 			UUID:     "00000000-0000-0000-0000-000000000001",
@@ -76,7 +63,7 @@ var _ = Describe("PostUserHandler", func() {
 		}`))
 		Expect(res.Code).To(Equal(http.StatusCreated))
 
-		userData, err := db.GetUser(user.UUID)
+		userData, err := db.GetUser(context.Background(), user.UUID)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(userData.UUID).To(Equal(user.UUID))
 		Expect(userData.Email).To(Equal(user.Email))
@@ -107,7 +94,7 @@ var _ = Describe("PostUserHandler", func() {
 		Expect(handler(ctx)).To(BeAssignableToTypeOf(ValidationError{}))
 	})
 
-	It("should return BadRequest if a user with the same username exists", func() {
+	It("should return Conflict if a user with the same username exists", func() {
 		payload := `{
 			"user_uuid": "00000000-0000-0000-0000-000000000001", 
 			"wrong_email_field": "e@ma.il", 
@@ -133,7 +120,48 @@ var _ = Describe("PostUserHandler", func() {
 		ctx.SetParamValues("00000000-0000-0000-0000-000000000001")
 
 		handler := PostUserHandler(db)
-		Expect(handler(ctx)).To(Succeed())
-		Expect(res.Code).To(Equal(http.StatusBadRequest))
+		err := handler(ctx)
+		Expect(errors.Is(err, database.ErrUsernameTaken)).To(BeTrue())
+
+		ErrorHandler(err, ctx)
+		Expect(res.Code).To(Equal(http.StatusConflict))
+		Expect(res.Body.String()).To(MatchJSON(`{
+			"message": "a user with this username already exists",
+			"field": "username"
+		}`))
+	})
+
+	It("should return Conflict if a user with the same uuid exists", func() {
+		payload := `{
+			"user_uuid": "11111111-1111-1111-1111-111111111111",
+			"user_email": "other@jefferson.com",
+			"username": "other@jefferson.com"
+		}`
+
+		req := httptest.NewRequest(echo.POST, "/", bytes.NewReader([]byte(payload)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+
+		server := NewServer(Config{
+			DB:                db,
+			BasicAuthUsername: "jeff",
+			BasicAuthPassword: "jefferson",
+			LogWriter:         GinkgoWriter,
+		})
+
+		ctx := server.AcquireContext()
+		ctx.Reset(req, res)
+		ctx.SetPath("/users/")
+
+		handler := PostUserHandler(db)
+		err := handler(ctx)
+		Expect(errors.Is(err, database.ErrUserExists)).To(BeTrue())
+
+		ErrorHandler(err, ctx)
+		Expect(res.Code).To(Equal(http.StatusConflict))
+		Expect(res.Body.String()).To(MatchJSON(`{
+			"message": "a user with this uuid already exists",
+			"field": "user_uuid"
+		}`))
 	})
 })
@@ -8,19 +8,27 @@ import (
 	"github.com/labstack/echo"
 )
 
-func PutDocumentHandler(db *database.DB) echo.HandlerFunc {
+func PutDocumentHandler(db database.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var document database.Document
 		err := c.Bind(&document)
 		if err != nil {
-			return InternalServerError{err}
+			return err
+		}
+
+		// A document may be scheduled to come into force in the future, but
+		// it cannot be backdated
+		now := time.Now()
+		if document.ValidFrom.IsZero() {
+			document.ValidFrom = now
+		} else if document.ValidFrom.Before(now) {
+			return BadRequestError{"valid_from must not be in the past"}
 		}
 
 		document.Name = c.Param("name")
-		document.ValidFrom = time.Now()
-		err = db.PutDocument(document)
+		err = db.PutDocument(c.Request().Context(), document)
 		if err != nil {
-			return InternalServerError{err}
+			return err
 		}
 
 		return c.NoContent(http.StatusCreated)
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,25 +17,10 @@ import (
 )
 
 var _ = Describe("PutDocumentHandler", func() {
-	var (
-		db     *database.DB
-		tempDB *database.TempDB
-	)
+	var db *database.MemoryStore
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
-	})
-
-	AfterEach(func() {
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
+		db = database.NewMemoryStore()
 	})
 
 	It("should accept a document", func() {
@@ -58,10 +44,78 @@ var _ = Describe("PutDocumentHandler", func() {
 		Expect(res.Body.String()).To(BeEmpty())
 		Expect(res.Code).To(Equal(http.StatusCreated))
 
-		document, err := db.GetDocument(inputName)
+		document, err := db.GetDocument(context.Background(), inputName)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(document.Name).To(Equal(inputName))
 		Expect(document.Content).To(Equal(input.Content))
 		Expect(document.ValidFrom).To(BeTemporally("~", time.Now(), time.Minute))
 	})
+
+	It("should accept a document scheduled for the future", func() {
+		inputName := "one"
+		validFrom := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+		input := database.Document{
+			Content:   "content one",
+			ValidFrom: validFrom,
+		}
+
+		buf, err := json.Marshal(input)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(echo.PUT, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues(inputName)
+
+		handler := PutDocumentHandler(db)
+		Expect(handler(ctx)).To(Succeed())
+		Expect(res.Code).To(Equal(http.StatusCreated))
+
+		document, err := db.GetUpcomingDocument(context.Background(), inputName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(document.ValidFrom).To(BeTemporally("==", validFrom))
+	})
+
+	It("should reject a document with a valid_from in the past", func() {
+		input := database.Document{
+			Content:   "content one",
+			ValidFrom: time.Now().Add(-24 * time.Hour),
+		}
+
+		buf, err := json.Marshal(input)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(echo.PUT, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := PutDocumentHandler(db)
+		Expect(handler(ctx)).To(BeAssignableToTypeOf(BadRequestError{}))
+	})
+
+	It("should return a conflict when a later version is already scheduled", func() {
+		Expect(db.PutDocument(context.Background(), database.Document{
+			Name:      "one",
+			Content:   "scheduled content",
+			ValidFrom: time.Now().Add(24 * time.Hour),
+		})).To(Succeed())
+
+		buf, err := json.Marshal(database.Document{Content: "new content"})
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(echo.PUT, "/", bytes.NewReader(buf))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, res)
+		ctx.SetPath("/documents/:name")
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("one")
+
+		handler := PutDocumentHandler(db)
+		Expect(handler(ctx)).To(MatchError(database.ErrDocumentHistoryConflict))
+	})
 })
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const maxPageLimit = 1000
+
+// parsePagination reads the optional limit and offset query params. A zero
+// limit means no limit was requested.
+func parsePagination(c echo.Context) (limit int, offset int, err error) {
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, BadRequestError{fmt.Sprintf("limit must be an integer between 1 and %d", maxPageLimit)}
+		}
+	}
+
+	if value := c.QueryParam("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, BadRequestError{"offset must be a non-negative integer"}
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// parseTimeParam reads an optional RFC3339 timestamp query param.
+func parseTimeParam(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, BadRequestError{fmt.Sprintf("%s must be an RFC3339 timestamp", name)}
+	}
+
+	return &t, nil
+}
@@ -3,20 +3,35 @@ package api
 import (
 	"context"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/alphagov/paas-accounts/database"
+	"github.com/alphagov/paas-accounts/markdown"
 	"github.com/go-playground/validator"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/labstack/gommon/log"
 )
 
 type Config struct {
-	DB                *database.DB
+	DB                database.Store
 	BasicAuthUsername string
 	BasicAuthPassword string
-	LogWriter         io.Writer
+	// BasicAuthPreviousPassword is also accepted while the basic auth
+	// password is being rotated
+	BasicAuthPreviousPassword string
+	Clients                   []Client
+	// TokenVerifier, if set, lets clients authenticate with a bearer token
+	TokenVerifier *TokenVerifier
+	// TrustedProxies are the ranges of the proxies whose X-Forwarded-For
+	// entries are believed, or DefaultTrustedProxies if nil
+	TrustedProxies []*net.IPNet
+	// DrainDelay is how long ListenAndServe keeps serving requests, while
+	// reporting itself as not ready, before it shuts down
+	DrainDelay time.Duration
+	LogWriter  io.Writer
 }
 
 type EchoCustomValidator struct {
@@ -27,35 +42,89 @@ func (ecv *EchoCustomValidator) Validate(i interface{}) error {
 	return ecv.validator.Struct(i)
 }
 
-// New creates a new server. Use ListenAndServe to start accepting connections.
-func NewServer(config Config) *echo.Echo {
+// Check returns an error if the config is one NewServer would refuse.
+func (config Config) Check() error {
+	_, err := clients(config)
+	return err
+}
+
+// Server is the echo server for the API, along with the state it shares with
+// ListenAndServe.
+type Server struct {
+	*echo.Echo
+	state *serverState
+}
+
+// New creates a new server. Use ListenAndServe to start accepting
+// connections. It panics if the config is invalid, which Check reports.
+func NewServer(config Config) *Server {
+	clients, err := clients(config)
+	if err != nil {
+		panic(err)
+	}
 
 	e := echo.New()
+	state := &serverState{drainDelay: config.DrainDelay}
+	registry := newRegistry(config)
+
+	trustedProxies := config.TrustedProxies
+	if trustedProxies == nil {
+		trustedProxies = DefaultTrustedProxies
+	}
+
+	e.Use(middleware.RequestID())
+	e.Use(clientIP(trustedProxies))
+	e.Use(instrument(registry))
+	e.Use(accessLog())
 	e.Use(middleware.Recover())
-	e.Use(basicAuth(config.BasicAuthUsername, config.BasicAuthPassword))
+	e.Use(authenticate(newClientStore(clients), config.TokenVerifier))
 
 	if config.LogWriter != nil {
 		e.Logger.SetOutput(config.LogWriter)
 	}
+	e.Logger.SetLevel(log.INFO)
 
 	e.Validator = &EchoCustomValidator{validator: validator.New()}
 
+	documentsRead := requireScope(ScopeDocumentsRead)
+	documentsWrite := requireScope(ScopeDocumentsWrite)
+	agreementsRead := requireScope(ScopeAgreementsRead)
+	agreementsWrite := requireScope(ScopeAgreementsWrite)
+	usersRead := requireScope(ScopeUsersRead)
+	usersWrite := requireScope(ScopeUsersWrite)
+
+	renderer := markdown.NewRenderer(documentHTMLCacheSize)
+
 	e.GET("/", status)
-	e.POST("/agreements", PostAgreementsHandler(config.DB))
-	e.POST("/agreements/", PostAgreementsHandler(config.DB))
-	e.PUT("/documents/:name", PutDocumentHandler(config.DB))
-	e.GET("/documents/:name", GetDocumentHandler(config.DB))
-	e.GET("/users/:uuid", GetUserHandler(config.DB))
-	e.GET("/users", GetUsersHandler(config.DB))
-	e.GET("/users/", GetUsersHandler(config.DB))
-	e.POST("/users", PostUserHandler(config.DB))
-	e.POST("/users/", PostUserHandler(config.DB))
-	e.PATCH("/users/:uuid", PatchUserHandler(config.DB))
-	e.GET("/users/:uuid/documents", GetUserDocumentsHandler(config.DB))
+	e.GET("/healthz", HealthzHandler)
+	e.GET("/readyz", ReadyzHandler(config.DB, state.isDraining))
+	e.GET("/metrics", metricsHandler(registry), requireScope(ScopeMetricsRead))
+	e.POST("/agreements", PostAgreementsHandler(config.DB), requireScopeOrSelf(ScopeAgreementsWrite))
+	e.POST("/agreements/", PostAgreementsHandler(config.DB), requireScopeOrSelf(ScopeAgreementsWrite))
+	e.POST("/agreements/revocations", PostRevocationsHandler(config.DB), agreementsWrite)
+	e.GET("/documents", GetDocumentsHandler(config.DB), documentsRead)
+	e.GET("/documents/", GetDocumentsHandler(config.DB), documentsRead)
+	e.PUT("/documents/:name", PutDocumentHandler(config.DB), documentsWrite)
+	e.GET("/documents/:name", GetDocumentHandler(config.DB, renderer), documentsRead)
+	e.GET("/documents/:name/outstanding", GetOutstandingUsersHandler(config.DB), usersRead)
+	e.GET("/documents/:name/diff", GetDocumentDiffHandler(config.DB), documentsRead)
+	e.GET("/documents/:name/versions", GetDocumentVersionsHandler(config.DB), documentsRead)
+	e.GET("/documents/:name/versions/:version", GetDocumentVersionHandler(config.DB), documentsRead)
+	e.GET("/users/:uuid", GetUserHandler(config.DB), usersRead)
+	e.GET("/users", GetUsersHandler(config.DB), usersRead)
+	e.GET("/users/", GetUsersHandler(config.DB), usersRead)
+	e.POST("/users", PostUserHandler(config.DB), usersWrite)
+	e.POST("/users/", PostUserHandler(config.DB), usersWrite)
+	e.PATCH("/users/:uuid", PatchUserHandler(config.DB), usersWrite)
+	e.DELETE("/users/:uuid", DeleteUserHandler(config.DB), usersWrite)
+	e.GET("/users/:uuid/documents", GetUserDocumentsHandler(config.DB), requireScopeOrSelf(ScopeAgreementsRead))
+	e.GET("/users/:uuid/agreements", GetUserAgreementsHandler(config.DB), agreementsRead)
+	e.GET("/users/:uuid/revocations", GetUserRevocationsHandler(config.DB), agreementsRead)
+	e.GET("/users/:uuid/export", GetUserExportHandler(config.DB), requireScope(ScopeUsersRead, ScopeAgreementsRead))
 
 	e.HTTPErrorHandler = ErrorHandler
 
-	return e
+	return &Server{Echo: e, state: state}
 }
 
 func status(c echo.Context) error {
@@ -64,8 +133,22 @@ func status(c echo.Context) error {
 	}, "  ")
 }
 
-func ListenAndServe(ctx context.Context, e *echo.Echo, addr string) error {
-	ctx, shutdown := context.WithCancel(ctx)
+// shutdownTimeout is how long requests still in flight once draining is over
+// are given to finish. Along with the drain delay it must be shorter than the
+// time Cloud Foundry waits before killing the process, which is 10s.
+const shutdownTimeout = 5 * time.Second
+
+func ListenAndServe(parentCtx context.Context, server *Server, addr string) error {
+	e := server.Echo
+	ctx, shutdown := context.WithCancel(parentCtx)
+
+	// Requests are given a context that is cancelled once draining is over,
+	// so that any database queries still running are stopped
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	e.Server.BaseContext = func(net.Listener) context.Context {
+		return requestsCtx
+	}
 
 	go func() {
 		defer shutdown()
@@ -79,32 +162,16 @@ func ListenAndServe(ctx context.Context, e *echo.Echo, addr string) error {
 		}
 	}()
 
-	// Wait for parent context to get cancelled then drain with a 10s timeout
+	// Wait for parent context to get cancelled, then report not ready for
+	// the drain delay so that no more requests are routed to this instance
 	<-ctx.Done()
-	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 5*time.Second)
+	server.state.setDraining()
+	if parentCtx.Err() != nil {
+		time.Sleep(server.state.drainDelay)
+	}
+
+	// Then give the requests in flight until the shutdown timeout to finish
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancelDrain()
 	return e.Shutdown(drainCtx)
 }
-
-func basicAuth(masterUsername string, masterPassword string) echo.MiddlewareFunc {
-	if masterUsername == "" {
-		panic("a basic auth username is required")
-	}
-	if masterPassword == "" {
-		panic("a basic auth password is required")
-	}
-	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
-		Skipper: func(c echo.Context) bool {
-			if c.Path() == "/" {
-				return true
-			}
-			return false
-		},
-		Validator: func(requestUsername, requestPassword string, c echo.Context) (bool, error) {
-			if requestUsername == masterUsername && requestPassword == masterPassword {
-				return true, nil
-			}
-			return false, nil
-		},
-	})
-}
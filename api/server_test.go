@@ -3,6 +3,7 @@ package api_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-playground/validator"
 	"io"
 	"io/ioutil"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo"
+	"github.com/lib/pq"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -24,9 +26,8 @@ var _ = Describe("Server", func() {
 
 	var (
 		shutdownServer        context.CancelFunc
-		db                    *database.DB
-		tempDB                *database.TempDB
-		server                *echo.Echo
+		db                    *database.MemoryStore
+		server                *Server
 		addr                  string
 		cleanShutdownComplete chan struct{}
 		basicUsername         = "jeff"
@@ -34,14 +35,7 @@ var _ = Describe("Server", func() {
 	)
 
 	BeforeEach(func() {
-		var err error
-		tempDB, err = database.NewTempDB()
-		Expect(err).ToNot(HaveOccurred())
-
-		db, err = database.NewDB(tempDB.TempConnectionString)
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(db.Init()).To(Succeed())
+		db = database.NewMemoryStore()
 
 		var ctx context.Context
 		ctx, shutdownServer = context.WithCancel(context.Background())
@@ -66,8 +60,6 @@ var _ = Describe("Server", func() {
 	AfterEach(func() {
 		shutdownServer()
 		Eventually(cleanShutdownComplete, 10*time.Second).Should(BeClosed())
-		db.Close()
-		Expect(tempDB.Close()).To(Succeed())
 	})
 
 	DescribeTable("should expose status route to public without basic auth",
@@ -103,16 +95,26 @@ var _ = Describe("Server", func() {
 			b, err := ioutil.ReadAll(res.Body)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(b)).To(MatchJSON(`{
-				"message": "Unauthorized"
+				"message": "Unauthorized",
+				"request_id": "` + res.Header.Get(echo.HeaderXRequestID) + `"
 			}`))
 		},
 		Entry("POST /agreements", "POST", "/agreements"),
+		Entry("POST /agreements/revocations", "POST", "/agreements/revocations"),
+		Entry("GET /documents", "GET", "/documents"),
 		Entry("PUT /documents/:name", "PUT", "/documents/doc-one"),
 		Entry("GET /documents/:name", "GET", "/documents/doc-one"),
+		Entry("GET /documents/:name/outstanding", "GET", "/documents/doc-one/outstanding"),
+		Entry("GET /documents/:name/versions", "GET", "/documents/doc-one/versions"),
+		Entry("GET /documents/:name/versions/:version", "GET", "/documents/doc-one/versions/1"),
 		Entry("GET /users/569a91c6-7f5d-4dac-82a2-db85cc595c75/documents", "GET", "/users/"),
+		Entry("GET /users/:uuid/agreements", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/agreements"),
+		Entry("GET /users/:uuid/revocations", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/revocations"),
+		Entry("GET /users/:uuid/export", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/export"),
 		Entry("GET /users?uuids=569a91c6-7f5d-4dac-82a2-db85cc595c75", "GET", "/users"),
 		Entry("POST /users/", "POST", "/users/"),
 		Entry("PATCH /users/:uuid", "PATCH", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75"),
+		Entry("DELETE /users/:uuid", "DELETE", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75"),
 	)
 
 	DescribeTable("should allow access with basic auth credentials",
@@ -131,17 +133,63 @@ var _ = Describe("Server", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res.StatusCode).To(Equal(responseCode))
 		},
-		Entry("POST /agreements", "POST", "/agreements", 500),
-		Entry("POST /agreements/", "POST", "/agreements/", 500),
-		Entry("PUT /documents/:name", "PUT", "/documents/doc-one", 500),
+		Entry("POST /agreements", "POST", "/agreements", 404),
+		Entry("POST /agreements/", "POST", "/agreements/", 404),
+		Entry("POST /agreements/revocations", "POST", "/agreements/revocations", 400),
+		Entry("GET /documents", "GET", "/documents", 200),
+		Entry("GET /documents/", "GET", "/documents/", 200),
+		Entry("PUT /documents/:name", "PUT", "/documents/doc-one", 400),
 		Entry("GET /documents/:name", "GET", "/documents/doc-one", 404),
+		Entry("GET /documents/:name/outstanding", "GET", "/documents/doc-one/outstanding", 404),
+		Entry("GET /documents/:name/versions", "GET", "/documents/doc-one/versions", 404),
+		Entry("GET /documents/:name/versions/:version", "GET", "/documents/doc-one/versions/1", 404),
 		Entry("GET /users/:uuid/documents", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/documents", 200),
+		Entry("GET /users/:uuid/agreements", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/agreements", 404),
+		Entry("GET /users/:uuid/revocations", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/revocations", 404),
+		Entry("GET /users/:uuid/export", "GET", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75/export", 404),
 		Entry("GET /users", "GET", "/users", 400),
 		Entry("GET /users/", "GET", "/users/", 400),
 		Entry("POST /users/", "POST", "/users/", 400),
 		Entry("PATCH /users/:uuid", "PATCH", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75", 400),
+		Entry("DELETE /users/:uuid", "DELETE", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75", 404),
+	)
+
+	DescribeTable("should reject a body that is not valid JSON as a bad request",
+		func(method, path string) {
+			url := "http://" + addr + path
+			req, err := http.NewRequest(method, url, strings.NewReader(`{"user_uuid": `))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+			req.SetBasicAuth(basicUsername, basicPassword)
+			client := &http.Client{}
+			res, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+		},
+		Entry("POST /agreements", "POST", "/agreements"),
+		Entry("POST /agreements/revocations", "POST", "/agreements/revocations"),
+		Entry("PUT /documents/:name", "PUT", "/documents/doc-one"),
+		Entry("POST /users/", "POST", "/users/"),
+		Entry("PATCH /users/:uuid", "PATCH", "/users/569a91c6-7f5d-4dac-82a2-db85cc595c75"),
 	)
 
+	It("should propagate the request id to the response", func() {
+		req, err := http.NewRequest("GET", "http://"+addr+"/documents/doc-one", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.SetBasicAuth(basicUsername, basicPassword)
+		req.Header.Set(echo.HeaderXRequestID, "support-ticket-123")
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(res.Header.Get(echo.HeaderXRequestID)).To(Equal("support-ticket-123"))
+		b, err := ioutil.ReadAll(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(MatchJSON(`{
+			"message": "document not found",
+			"request_id": "support-ticket-123"
+		}`))
+	})
+
 	Describe("ErrorHandler", func() {
 		var (
 			req *http.Request
@@ -181,6 +229,82 @@ var _ = Describe("Server", func() {
 			Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
 		})
 
+		It("should return a BadRequestError as a 400", func() {
+			err := BadRequestError{Message: "I was bad"}
+			ErrorHandler(err, ctx)
+			Expect(res.Body).To(MatchJSON(`{
+				"message": "` + err.Error() + `"
+			}`))
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should return a ConflictError as a 409", func() {
+			err := ConflictError{Message: "I conflicted"}
+			ErrorHandler(err, ctx)
+			Expect(res.Body).To(MatchJSON(`{
+				"message": "` + err.Error() + `"
+			}`))
+			Expect(res.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("should name the conflicting field of a ConflictError", func() {
+			err := ConflictError{Message: "I conflicted", Field: "username"}
+			ErrorHandler(err, ctx)
+			Expect(res.Body).To(MatchJSON(`{
+				"message": "` + err.Error() + `",
+				"field": "username"
+			}`))
+			Expect(res.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("should return an UnprocessableEntityError as a 422", func() {
+			err := UnprocessableEntityError{Message: "I was unprocessable"}
+			ErrorHandler(err, ctx)
+			Expect(res.Body).To(MatchJSON(`{
+				"message": "` + err.Error() + `"
+			}`))
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+		})
+
+		DescribeTable("should map database errors to the matching status",
+			func(err error, code int) {
+				ErrorHandler(fmt.Errorf("wrapped: %w", err), ctx)
+				Expect(res.Code).To(Equal(code))
+				Expect(res.Header().Get("Content-Type")).To(Equal(echo.MIMEApplicationJSONCharsetUTF8))
+			},
+			Entry("user not found", database.ErrUserNotFound, http.StatusNotFound),
+			Entry("document not found", database.ErrDocumentNotFound, http.StatusNotFound),
+			Entry("agreement not found", database.ErrAgreementNotFound, http.StatusNotFound),
+			Entry("agreement document not found", database.ErrAgreementDocumentNotFound, http.StatusUnprocessableEntity),
+			Entry("agreement document superseded", database.ErrAgreementDocumentSuperseded, http.StatusConflict),
+			Entry("document history conflict", database.ErrDocumentHistoryConflict, http.StatusConflict),
+			Entry("immutable history", database.ErrImmutable, http.StatusConflict),
+			Entry("user exists", database.ErrUserExists, http.StatusConflict),
+			Entry("username taken", database.ErrUsernameTaken, http.StatusConflict),
+			Entry("user erased", database.ErrUserErased, http.StatusConflict),
+			Entry("invalid input", database.ErrInvalidInput, http.StatusBadRequest),
+			Entry("query cancelled", database.ErrCanceled, http.StatusServiceUnavailable),
+			Entry("query timed out", database.ErrTimeout, http.StatusGatewayTimeout),
+		)
+
+		It("should not return the message from Postgres for invalid input", func() {
+			err := &database.Error{Err: database.ErrInvalidInput, Cause: &pq.Error{
+				Message:    `new row for relation "users" violates check constraint "users_email_check"`,
+				Constraint: "users_email_check",
+			}}
+			ErrorHandler(err, ctx)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(res.Body).To(MatchJSON(`{
+				"message": "the request contains a value that is not valid"
+			}`))
+		})
+
+		It("should report a query that timed out as a 504 even when wrapped as an InternalServerError", func() {
+			err := InternalServerError{InternalError: fmt.Errorf("wrapped: %w", database.ErrTimeout)}
+			ErrorHandler(err, ctx)
+			Expect(res.Code).To(Equal(http.StatusGatewayTimeout))
+		})
+
 		It("should return an InternalServerError as a 500", func() {
 			err := InternalServerError{InternalError: errors.New("internal error")}
 			ErrorHandler(err, ctx)
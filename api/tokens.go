@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenVerifier checks bearer tokens issued by UAA, offline, against the
+// public keys UAA signs them with.
+type TokenVerifier struct {
+	keys map[string]*rsa.PublicKey
+	// Audience must be one of the audiences of a token, so that tokens UAA
+	// issued for other services, such as the cf CLI, are not accepted
+	Audience string
+	// Issuer must be the issuer of a token
+	Issuer string
+	// ScopePrefix is removed from the scopes in a token to give the scopes
+	// of the API they grant. Scopes without the prefix are ignored.
+	ScopePrefix string
+}
+
+// jsonWebKeySet is the format UAA publishes its keys in at /token_keys.
+type jsonWebKeySet struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// NewTokenVerifier creates a TokenVerifier from either a PEM encoded RSA
+// public key or a JSON Web Key Set. The audience and issuer are required.
+func NewTokenVerifier(keyData []byte, audience string, issuer string, scopePrefix string) (*TokenVerifier, error) {
+	if audience == "" {
+		return nil, errors.New("a token audience is required")
+	}
+	if issuer == "" {
+		return nil, errors.New("a token issuer is required")
+	}
+
+	verifier := &TokenVerifier{
+		keys:        map[string]*rsa.PublicKey{},
+		Audience:    audience,
+		Issuer:      issuer,
+		ScopePrefix: scopePrefix,
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(keyData), []byte("{")) {
+		key, err := jwt.ParseRSAPublicKeyFromPEM(keyData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token key: %s", err)
+		}
+		verifier.keys[""] = key
+		return verifier, nil
+	}
+
+	var keySet jsonWebKeySet
+	if err := json.Unmarshal(keyData, &keySet); err != nil {
+		return nil, fmt.Errorf("invalid token key set: %s", err)
+	}
+	for _, k := range keySet.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token key %s: %s", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token key %s: %s", k.Kid, err)
+		}
+		verifier.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(verifier.keys) == 0 {
+		return nil, errors.New("invalid token key set: no RSA keys")
+	}
+
+	return verifier, nil
+}
+
+// Verify checks the signature, expiry, audience and issuer of a token and
+// returns the client it was issued to. If the token was issued on behalf of a
+// user, the client may only act for that user.
+func (verifier *TokenVerifier) Verify(tokenString string) (Client, error) {
+	token, err := jwt.Parse(tokenString, verifier.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithAudience(verifier.Audience),
+		jwt.WithIssuer(verifier.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Client{}, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	client := Client{}
+	client.Name, _ = claims["client_id"].(string)
+	if client.Name == "" {
+		return Client{}, errors.New("token has no client_id")
+	}
+	client.UserUUID, _ = claims["user_id"].(string)
+
+	scopes, _ := claims["scope"].([]interface{})
+	for _, s := range scopes {
+		scope, _ := s.(string)
+		if strings.HasPrefix(scope, verifier.ScopePrefix) && isScope(strings.TrimPrefix(scope, verifier.ScopePrefix)) {
+			client.Scopes = append(client.Scopes, strings.TrimPrefix(scope, verifier.ScopePrefix))
+		}
+	}
+
+	return client, nil
+}
+
+func (verifier *TokenVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := verifier.keys[kid]; ok {
+		return key, nil
+	}
+	if key, ok := verifier.keys[""]; ok && len(verifier.keys) == 1 {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %s", kid)
+}
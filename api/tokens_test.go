@@ -0,0 +1,273 @@
+package api_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var _ = Describe("Tokens", func() {
+	var (
+		key      *rsa.PrivateKey
+		keyPEM   []byte
+		verifier *TokenVerifier
+	)
+
+	const (
+		userUUID      = "00000000-0000-0000-0000-000000000001"
+		otherUserUUID = "00000000-0000-0000-0000-000000000002"
+		audience      = "paas-accounts"
+		issuer        = "https://uaa.example.com/oauth/token"
+	)
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(key)
+		Expect(err).ToNot(HaveOccurred())
+		return signed
+	}
+
+	userClaims := func(scopes ...string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"client_id": "paas-admin",
+			"user_id":   userUUID,
+			"scope":     scopes,
+			"aud":       []string{"cloud_controller", audience},
+			"iss":       issuer,
+			"exp":       time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).ToNot(HaveOccurred())
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+		verifier, err = NewTokenVerifier(keyPEM, audience, issuer, "paas-accounts.")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("TokenVerifier", func() {
+		It("should return the client and the scopes it was granted", func() {
+			client, err := verifier.Verify(sign(jwt.MapClaims{
+				"client_id": "billing",
+				"scope":     []string{"paas-accounts.users:read", "paas-accounts.unknown", "cloud_controller.read"},
+				"aud":       audience,
+				"iss":       issuer,
+				"exp":       time.Now().Add(time.Hour).Unix(),
+			}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.Name).To(Equal("billing"))
+			Expect(client.Scopes).To(Equal([]string{ScopeUsersRead}))
+			Expect(client.UserUUID).To(BeEmpty())
+		})
+
+		It("should return the user a token was issued for", func() {
+			client, err := verifier.Verify(sign(userClaims()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.UserUUID).To(Equal(userUUID))
+		})
+
+		It("should accept a key from a JSON Web Key Set", func() {
+			e := big.NewInt(int64(key.PublicKey.E)).Bytes()
+			keySet := `{"keys": [{
+				"kid": "key-1",
+				"kty": "RSA",
+				"n": "` + base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()) + `",
+				"e": "` + base64.RawURLEncoding.EncodeToString(e) + `"
+			}]}`
+
+			verifier, err := NewTokenVerifier([]byte(keySet), audience, issuer, "paas-accounts.")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = verifier.Verify(sign(userClaims()))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should reject an expired token", func() {
+			claims := userClaims()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			_, err := verifier.Verify(sign(claims))
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+		})
+
+		It("should reject a token without an expiry", func() {
+			claims := userClaims()
+			delete(claims, "exp")
+			_, err := verifier.Verify(sign(claims))
+			Expect(err).To(MatchError(jwt.ErrTokenRequiredClaimMissing))
+		})
+
+		It("should reject a token signed with another key", func() {
+			otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).ToNot(HaveOccurred())
+			signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, userClaims()).SignedString(otherKey)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = verifier.Verify(signed)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject a token signed with a shared secret", func() {
+			signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims()).SignedString(keyPEM)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = verifier.Verify(signed)
+			Expect(err).To(MatchError(ContainSubstring("signing method HS256 is invalid")))
+		})
+
+		It("should reject a token issued for another audience", func() {
+			claims := userClaims()
+			claims["aud"] = []string{"cloud_controller", "password"}
+			_, err := verifier.Verify(sign(claims))
+			Expect(err).To(MatchError(jwt.ErrTokenInvalidAudience))
+
+			delete(claims, "aud")
+			_, err = verifier.Verify(sign(claims))
+			Expect(err).To(MatchError(jwt.ErrTokenRequiredClaimMissing))
+		})
+
+		It("should reject a token from another issuer", func() {
+			claims := userClaims()
+			claims["iss"] = "https://uaa.other.example.com/oauth/token"
+			_, err := verifier.Verify(sign(claims))
+			Expect(err).To(MatchError(jwt.ErrTokenInvalidIssuer))
+
+			delete(claims, "iss")
+			_, err = verifier.Verify(sign(claims))
+			Expect(err).To(MatchError(jwt.ErrTokenRequiredClaimMissing))
+		})
+
+		It("should reject a key that is not PEM or a key set", func() {
+			_, err := NewTokenVerifier([]byte("not a key"), audience, issuer, "")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should need an audience and issuer", func() {
+			_, err := NewTokenVerifier(keyPEM, "", issuer, "paas-accounts.")
+			Expect(err).To(MatchError("a token audience is required"))
+			_, err = NewTokenVerifier(keyPEM, audience, "", "paas-accounts.")
+			Expect(err).To(MatchError("a token issuer is required"))
+		})
+	})
+
+	Describe("bearer authentication", func() {
+		var server *Server
+
+		BeforeEach(func() {
+			server = NewServer(Config{
+				BasicAuthUsername: "jeff",
+				BasicAuthPassword: "jefferson",
+				TokenVerifier:     verifier,
+				LogWriter:         GinkgoWriter,
+			})
+		})
+
+		request := func(method, path, token, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			return res
+		}
+
+		It("should reject an invalid token", func() {
+			res := request(echo.GET, "/users/"+userUUID+"/documents", "not-a-token", "")
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject a request that needs a scope the token does not have", func() {
+			res := request(echo.GET, "/users/"+userUUID, sign(userClaims()), "")
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("should not let a user see another user's documents", func() {
+			res := request(echo.GET, "/users/"+otherUserUUID+"/documents", sign(userClaims()), "")
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("should not let a user agree on behalf of another user", func() {
+			res := request(echo.POST, "/agreements", sign(userClaims()), `{
+				"user_uuid": "`+otherUserUUID+`",
+				"document_name": "document-one"
+			}`)
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("should still accept basic auth", func() {
+			req := httptest.NewRequest(echo.DELETE, "/users/not-a-uuid", nil)
+			req.SetBasicAuth("jeff", "jefferson")
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		Context("with a store", func() {
+			var db *database.MemoryStore
+
+			BeforeEach(func() {
+				db = database.NewMemoryStore()
+
+				Expect(db.PutDocument(context.Background(), database.Document{
+					Name:      "document-one",
+					Content:   "content one",
+					ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+				})).To(Succeed())
+
+				server = NewServer(Config{
+					DB:                db,
+					BasicAuthUsername: "jeff",
+					BasicAuthPassword: "jefferson",
+					TokenVerifier:     verifier,
+					LogWriter:         GinkgoWriter,
+				})
+			})
+
+			It("should let a user agree to a document for themselves", func() {
+				res := request(echo.POST, "/agreements", sign(userClaims()), `{
+					"user_uuid": "`+userUUID+`",
+					"document_name": "document-one"
+				}`)
+				Expect(res.Code).To(Equal(http.StatusCreated))
+
+				agreements, err := db.GetAgreementsForUserUUID(context.Background(), userUUID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(agreements).To(HaveLen(1))
+				Expect(agreements[0].Principal).To(Equal(strPoint("paas-admin")))
+
+				res = request(echo.GET, "/users/"+userUUID+"/documents", sign(userClaims()), "")
+				Expect(res.Code).To(Equal(http.StatusOK))
+			})
+
+			It("should let a client with the scope agree on behalf of any user", func() {
+				res := request(echo.POST, "/agreements", sign(userClaims("paas-accounts.agreements:write")), `{
+					"user_uuid": "`+otherUserUUID+`",
+					"document_name": "document-one"
+				}`)
+				Expect(res.Code).To(Equal(http.StatusCreated))
+			})
+		})
+	})
+})
@@ -0,0 +1,127 @@
+// Package client calls the paas-accounts API over HTTP.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alphagov/paas-accounts/database"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Client authenticates with basic auth if Username is set, or with Token as
+// a bearer token.
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	Token    string
+
+	HTTPClient *http.Client
+}
+
+// New returns a client for the API at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		URL:        strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is a response from the API that was not a success.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (err Error) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%d %s", err.StatusCode, http.StatusText(err.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+// GetDocument returns the version of a document that is in force, or
+// ErrNotFound if there is none.
+func (c *Client) GetDocument(ctx context.Context, name string) (database.Document, error) {
+	var document database.Document
+	err := c.do(ctx, http.MethodGet, "/documents/"+url.PathEscape(name), nil, &document)
+	return document, err
+}
+
+// GetUpcomingDocument returns the next version of a document scheduled to
+// come into force, or ErrNotFound if there is none.
+func (c *Client) GetUpcomingDocument(ctx context.Context, name string) (database.Document, error) {
+	var document database.Document
+	err := c.do(ctx, http.MethodGet, "/documents/"+url.PathEscape(name)+"?upcoming=true", nil, &document)
+	return document, err
+}
+
+// PutDocument uploads a new version of a document. A zero ValidFrom brings
+// it into force straight away.
+func (c *Client) PutDocument(ctx context.Context, document database.Document) error {
+	body := map[string]interface{}{"content": document.Content}
+	if !document.ValidFrom.IsZero() {
+		body["valid_from"] = document.ValidFrom
+	}
+	return c.do(ctx, http.MethodPut, "/documents/"+url.PathEscape(document.Name), body, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return ErrNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var errorBody struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&errorBody)
+		return Error{StatusCode: res.StatusCode, Message: errorBody.Message}
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid response from %s %s: %s", method, path, err)
+	}
+	return nil
+}
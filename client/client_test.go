@@ -0,0 +1,75 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/alphagov/paas-accounts/api"
+	. "github.com/alphagov/paas-accounts/client"
+	"github.com/alphagov/paas-accounts/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		client *Client
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(api.NewServer(api.Config{
+			DB:                database.NewMemoryStore(),
+			BasicAuthUsername: "jeff",
+			BasicAuthPassword: "jefferson",
+			LogWriter:         GinkgoWriter,
+		}))
+		client = New(server.URL + "/")
+		client.Username = "jeff"
+		client.Password = "jefferson"
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload and fetch documents", func() {
+		_, err := client.GetDocument(ctx, "terms-of-use")
+		Expect(err).To(MatchError(ErrNotFound))
+
+		Expect(client.PutDocument(ctx, database.Document{Name: "terms-of-use", Content: "v1"})).To(Succeed())
+		document, err := client.GetDocument(ctx, "terms-of-use")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(document.Content).To(Equal("v1"))
+
+		_, err = client.GetUpcomingDocument(ctx, "terms-of-use")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("should schedule a version to come into force later", func() {
+		validFrom := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		Expect(client.PutDocument(ctx, database.Document{Name: "terms-of-use", Content: "v2", ValidFrom: validFrom})).To(Succeed())
+
+		document, err := client.GetUpcomingDocument(ctx, "terms-of-use")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(document.Content).To(Equal("v2"))
+		Expect(document.ValidFrom).To(BeTemporally("==", validFrom))
+	})
+
+	It("should return the message of an error", func() {
+		err := client.PutDocument(ctx, database.Document{Name: "terms-of-use", Content: "v1", ValidFrom: time.Now().Add(-time.Hour)})
+		Expect(err).To(Equal(Error{StatusCode: http.StatusBadRequest, Message: "valid_from must not be in the past"}))
+		Expect(err).To(MatchError("400 Bad Request: valid_from must not be in the past"))
+	})
+
+	It("should report bad credentials", func() {
+		client.Password = "wrong"
+		_, err := client.GetDocument(ctx, "terms-of-use")
+		Expect(err).To(BeAssignableToTypeOf(Error{}))
+		Expect(err.(Error).StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chainGenesis is the chain_hash before the first row of the chain.
+var chainGenesis = strings.Repeat("0", 64)
+
+// ChainProblem is a row of the hash chain that does not check out.
+type ChainProblem struct {
+	Seq     int64  `json:"seq"`
+	Row     string `json:"row"`
+	Problem string `json:"problem"`
+}
+
+// ChainReport is the result of checking the hash chain. Head is the
+// chain_hash of the last row, which can be recorded outside the database to
+// detect rows later removed from the end of the chain.
+type ChainReport struct {
+	Rows     int64          `json:"rows"`
+	Head     string         `json:"head"`
+	Problems []ChainProblem `json:"problems"`
+}
+
+type chainDocument struct {
+	validFrom time.Time
+	hash      string
+}
+
+// VerifyChain recomputes the content hash of every document, the hash chain
+// linking documents and agreements, and checks each agreement records the
+// hash of the version it applies to. It repeats what the triggers added by
+// sql/10_add_hash_chain.up.sql do in Go, with the agreement record of
+// sql/12_rebuild_hash_chain.up.sql, rather than trusting functions in the
+// database, and is not limited by the query timeout as it reads every row.
+// The client_ip and user_agent of agreements are not part of the chain, so
+// that they can be erased.
+func (db *DB) VerifyChain(ctx context.Context) (_ ChainReport, err error) {
+	defer func() { err = contextError(ctx, err) }()
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT
+			seq, chain_hash, 'document', name, NULL, valid_from, NULL, content, content_hash,
+			NULL, NULL
+		FROM
+			documents
+		UNION ALL
+		SELECT
+			seq, chain_hash, 'agreement', document_name, user_uuid::text, date, document_valid_from, NULL, document_content_hash,
+			principal, channel
+		FROM
+			agreements
+		ORDER BY
+			1
+	`)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	defer rows.Close()
+
+	report := ChainReport{Head: chainGenesis, Problems: []ChainProblem{}}
+	var last int64
+	documents := map[string][]chainDocument{}
+	for rows.Next() {
+		var (
+			seq                   int64
+			chainHash, kind, name string
+			date                  time.Time
+			documentValidFrom     *time.Time
+			userUUID, content     *string
+			contentHash           *string
+			provenance            Provenance
+		)
+		err := rows.Scan(
+			&seq, &chainHash, &kind, &name, &userUUID, &date, &documentValidFrom, &content, &contentHash,
+			&provenance.Principal, &provenance.Channel,
+		)
+		if err != nil {
+			return ChainReport{}, err
+		}
+
+		var row, record string
+		var problems []string
+		if kind == "document" {
+			row = fmt.Sprintf("document %s from %s", name, date.UTC().Format(time.RFC3339Nano))
+			record = chainField(&kind) + chainField(&name) + chainTime(&date) + chainField(contentHash)
+
+			if contentHash == nil || *contentHash != ContentHash(*content) {
+				problems = append(problems, "the content does not match its content_hash")
+			}
+			if contentHash != nil {
+				documents[name] = append(documents[name], chainDocument{date, *contentHash})
+			}
+		} else {
+			row = fmt.Sprintf("agreement of %s to %s at %s", *userUUID, name, date.UTC().Format(time.RFC3339Nano))
+			record = chainField(&kind) + chainField(userUUID) + chainField(&name) + chainTime(&date) +
+				chainTime(documentValidFrom) + chainField(contentHash) +
+				chainField(provenance.Principal) + chainField(provenance.Channel)
+
+			version, ok := chainVersion(documents[name], date, documentValidFrom)
+			if !ok {
+				problems = append(problems, "no earlier version of the document in the chain applies to it")
+			} else if contentHash == nil || *contentHash != version.hash {
+				problems = append(problems, "its document_content_hash does not match the version it applies to")
+			}
+		}
+
+		if expected := last + 1; seq != expected {
+			problems = append(problems, fmt.Sprintf("expected seq %d, rows are missing or duplicated", expected))
+		}
+		if chainLinkHash(report.Head, seq, record) != chainHash {
+			problems = append(problems, "the chain_hash does not match, the row or the one before it has been changed")
+		}
+		for _, problem := range problems {
+			report.Problems = append(report.Problems, ChainProblem{Seq: seq, Row: row, Problem: problem})
+		}
+
+		// Carry on from the hash as stored, so that a changed row is only
+		// reported once
+		last = seq
+		report.Rows++
+		report.Head = chainHash
+	}
+
+	return report, rows.Err()
+}
+
+// chainVersion finds the version of a document an agreement applies to,
+// among the versions before it in the chain, in the same way as the trigger
+// that records its document_content_hash.
+func chainVersion(versions []chainDocument, date time.Time, validFrom *time.Time) (chainDocument, bool) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if validFrom != nil && versions[i].validFrom.Equal(*validFrom) {
+			return versions[i], true
+		}
+		if validFrom == nil && !versions[i].validFrom.After(date) {
+			return versions[i], true
+		}
+	}
+	return chainDocument{}, false
+}
+
+// chainField encodes a value in the same way as the chain_field function, so
+// that different lists of values are never encoded the same.
+func chainField(value *string) string {
+	if value == nil {
+		return "N;"
+	}
+	return strconv.Itoa(len(*value)) + ":" + *value + ";"
+}
+
+func chainTime(value *time.Time) string {
+	if value == nil {
+		return chainField(nil)
+	}
+	s := value.UTC().Format("2006-01-02T15:04:05.000000Z")
+	return chainField(&s)
+}
+
+func chainLinkHash(previous string, seq int64, record string) string {
+	s := strconv.FormatInt(seq, 10)
+	return ContentHash(chainField(&previous) + chainField(&s) + record)
+}
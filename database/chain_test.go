@@ -0,0 +1,235 @@
+package database_test
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/alphagov/paas-accounts/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VerifyChain", func() {
+	var (
+		db     *DB
+		tempDB *TempDB
+		conn   *sql.DB
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDB, err = NewTempDB()
+		Expect(err).ToNot(HaveOccurred())
+
+		db, err = NewDB(tempDB.TempConnectionString)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.Init()).To(Succeed())
+
+		conn, err = sql.Open("postgres", tempDB.TempConnectionString)
+		Expect(err).ToNot(HaveOccurred())
+
+		first := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+		second := time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC)
+		Expect(db.PutDocument(ctx, Document{Name: "terms", Content: "version one", ValidFrom: first})).To(Succeed())
+		Expect(db.PostUser(ctx, User{UUID: "00000000-0000-0000-0000-000000000001"})).To(Succeed())
+		Expect(db.PutAgreement(ctx, Agreement{
+			UserUUID:     "00000000-0000-0000-0000-000000000001",
+			DocumentName: "terms",
+			Date:         first.Add(time.Hour),
+			Provenance:   Provenance{Principal: strPoint("paas-admin")},
+		})).To(Succeed())
+		Expect(db.PutDocument(ctx, Document{Name: "terms", Content: "version two", ValidFrom: second})).To(Succeed())
+		Expect(db.PutAgreement(ctx, Agreement{
+			UserUUID:            "00000000-0000-0000-0000-000000000001",
+			DocumentName:        "terms",
+			Date:                second.Add(time.Hour),
+			DocumentValidFrom:   &second,
+			DocumentContentHash: strPoint(ContentHash("version two")),
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		db.Close()
+		Expect(tempDB.Close()).To(Succeed())
+	})
+
+	tamper := func(table, statement string) {
+		_, err := conn.Exec(`ALTER TABLE ` + table + ` DISABLE TRIGGER USER`)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = conn.Exec(statement)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = conn.Exec(`ALTER TABLE ` + table + ` ENABLE TRIGGER USER`)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("should check out when nothing has been changed", func() {
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Rows).To(BeEquivalentTo(4))
+		Expect(report.Head).To(HaveLen(64))
+		Expect(report.Problems).To(BeEmpty())
+	})
+
+	It("should record the hash of the version an agreement applies to", func() {
+		agreements, err := db.GetAgreementsForUserUUID(ctx, "00000000-0000-0000-0000-000000000001")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agreements).To(HaveLen(2))
+		Expect(agreements[0].DocumentContentHash).To(Equal(strPoint(ContentHash("version one"))))
+	})
+
+	It("should reject an agreement with the hash of another version", func() {
+		validFrom := time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC)
+		err := db.PutAgreement(ctx, Agreement{
+			UserUUID:            "00000000-0000-0000-0000-000000000001",
+			DocumentName:        "terms",
+			Date:                time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC),
+			DocumentValidFrom:   &validFrom,
+			DocumentContentHash: strPoint(ContentHash("version one")),
+		})
+		Expect(err).To(MatchError(ErrAgreementDocumentHashMismatch))
+	})
+
+	It("should store the content hash of each version", func() {
+		versions, err := db.GetDocumentVersions(ctx, "terms")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(versions[0].ContentHash).To(Equal(ContentHash("version one")))
+		Expect(versions[1].ContentHash).To(Equal(ContentHash("version two")))
+	})
+
+	It("should report content that has been changed", func() {
+		tamper("documents", `UPDATE documents SET content = 'version 1' WHERE content = 'version one'`)
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Problems).To(ConsistOf(ChainProblem{
+			Seq:     1,
+			Row:     "document terms from 2001-01-01T00:00:00Z",
+			Problem: "the content does not match its content_hash",
+		}))
+	})
+
+	It("should report a row changed along with its hashes", func() {
+		tamper("documents", `UPDATE documents SET content = 'version 1', content_hash = sha256_hex('version 1') WHERE content = 'version one'`)
+		tamper("documents", `UPDATE documents SET chain_hash = chain_link_hash(chain_genesis(), seq, document_chain_record(documents)) WHERE seq = 1`)
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Problems).To(ConsistOf(
+			ChainProblem{Seq: 2, Row: "agreement of 00000000-0000-0000-0000-000000000001 to terms at 2001-01-01T01:00:00Z", Problem: "its document_content_hash does not match the version it applies to"},
+			ChainProblem{Seq: 2, Row: "agreement of 00000000-0000-0000-0000-000000000001 to terms at 2001-01-01T01:00:00Z", Problem: "the chain_hash does not match, the row or the one before it has been changed"},
+		))
+	})
+
+	It("should report provenance that has been changed", func() {
+		tamper("agreements", `UPDATE agreements SET principal = 'someone-else' WHERE principal = 'paas-admin'`)
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Problems).To(HaveLen(1))
+		Expect(report.Problems[0].Seq).To(BeEquivalentTo(2))
+		Expect(report.Problems[0].Problem).To(ContainSubstring("chain_hash does not match"))
+	})
+
+	It("should check out after a user's client_ip and user_agent are erased", func() {
+		Expect(db.PutAgreement(ctx, Agreement{
+			UserUUID:     "00000000-0000-0000-0000-000000000001",
+			DocumentName: "terms",
+			Date:         time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC),
+			Provenance:   Provenance{ClientIP: strPoint("198.51.100.1"), UserAgent: strPoint("Mozilla/5.0")},
+		})).To(Succeed())
+
+		_, err := db.EraseUser(ctx, "00000000-0000-0000-0000-000000000001", strPoint("paas-admin"))
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Rows).To(BeEquivalentTo(5))
+		Expect(report.Problems).To(BeEmpty())
+	})
+
+	It("should report a row that has been removed", func() {
+		tamper("agreements", `DELETE FROM agreements WHERE seq = 2`)
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Rows).To(BeEquivalentTo(3))
+		Expect(report.Problems).To(ContainElement(ChainProblem{
+			Seq:     3,
+			Row:     "document terms from 2002-01-01T00:00:00Z",
+			Problem: "expected seq 2, rows are missing or duplicated",
+		}))
+	})
+})
+
+var _ = Describe("VerifyChain after the chain is backfilled", func() {
+	var (
+		db     *DB
+		tempDB *TempDB
+		conn   *sql.DB
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDB, err = NewTempDB()
+		Expect(err).ToNot(HaveOccurred())
+
+		db, err = NewDB(tempDB.TempConnectionString)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.MigrateTo(9)).To(Succeed())
+
+		conn, err = sql.Open("postgres", tempDB.TempConnectionString)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		db.Close()
+		Expect(tempDB.Close()).To(Succeed())
+	})
+
+	It("should chain an agreement made before its version comes into force after that version", func() {
+		_, err := conn.Exec(`
+			INSERT INTO documents (name, content, valid_from) VALUES
+				('terms', 'version one', '2001-01-01T00:00:00Z'),
+				('terms', 'version two', '2003-01-01T00:00:00Z');
+			INSERT INTO users (uuid) VALUES ('00000000-0000-0000-0000-000000000001');
+			INSERT INTO agreements (user_uuid, document_name, date, document_valid_from, client_ip) VALUES
+				('00000000-0000-0000-0000-000000000001', 'terms', '2001-06-01T00:00:00Z', NULL, '198.51.100.1'),
+				('00000000-0000-0000-0000-000000000001', 'terms', '2002-01-01T00:00:00Z', '2003-01-01T00:00:00Z', NULL);
+		`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.MigrateUp()).To(Succeed())
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Rows).To(BeEquivalentTo(4))
+		Expect(report.Problems).To(BeEmpty())
+
+		agreements, err := db.GetAgreementsForUserUUID(ctx, "00000000-0000-0000-0000-000000000001")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agreements).To(HaveLen(2))
+		Expect(agreements[1].DocumentContentHash).To(Equal(strPoint(ContentHash("version two"))))
+	})
+
+	It("should rebuild a chain that recorded client_ip and user_agent", func() {
+		Expect(db.MigrateTo(10)).To(Succeed())
+		_, err := conn.Exec(`
+			INSERT INTO documents (name, content, valid_from) VALUES ('terms', 'version one', '2001-01-01T00:00:00Z');
+			INSERT INTO users (uuid) VALUES ('00000000-0000-0000-0000-000000000001');
+			INSERT INTO agreements (user_uuid, document_name, date, client_ip, user_agent) VALUES
+				('00000000-0000-0000-0000-000000000001', 'terms', '2001-06-01T00:00:00Z', '198.51.100.1', 'Mozilla/5.0');
+		`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.MigrateUp()).To(Succeed())
+
+		_, err = db.EraseUser(ctx, "00000000-0000-0000-0000-000000000001", strPoint("paas-admin"))
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := db.VerifyChain(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Rows).To(BeEquivalentTo(2))
+		Expect(report.Problems).To(BeEmpty())
+	})
+})
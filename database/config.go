@@ -0,0 +1,234 @@
+package database
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config configures how a DB connects to Postgres.
+type Config struct {
+	URL string
+	// QueryTimeout, if set, limits how long each method may take, unless
+	// the context passed to it has an earlier deadline
+	QueryTimeout time.Duration
+	// StatsInterval is how long the counts in Stats are reused for by the
+	// metrics before they are read again. Zero reads them on every scrape.
+	StatsInterval time.Duration
+
+	// MaxOpenConns and MaxIdleConns limit the connections in the pool. Zero
+	// means no limit on open connections, and the database/sql default of
+	// 2 idle connections.
+	MaxOpenConns int
+	MaxIdleConns int
+	// ConnMaxLifetime and ConnMaxIdleTime close connections that have been
+	// open, or idle, for longer. Zero means never.
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// SSLMode overrides the sslmode of the URL: disable, require, verify-ca
+	// or verify-full
+	SSLMode string
+	// SSLRootCert is a file of PEM encoded CA certificates to verify the
+	// server's certificate against, such as the RDS CA bundle
+	SSLRootCert string
+}
+
+// DefaultConfig suits an instance with little memory sharing a database with
+// other instances.
+var DefaultConfig = Config{
+	QueryTimeout:    10 * time.Second,
+	StatsInterval:   5 * time.Minute,
+	MaxOpenConns:    5,
+	MaxIdleConns:    2,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnMaxIdleTime: 5 * time.Minute,
+}
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// configFile is the format of DATABASE_CONFIG_FILE. Durations are strings
+// such as "30s". Settings left out keep their defaults.
+type configFile struct {
+	QueryTimeout    *duration `json:"query_timeout"`
+	StatsInterval   *duration `json:"stats_interval"`
+	MaxOpenConns    *int      `json:"max_open_conns"`
+	MaxIdleConns    *int      `json:"max_idle_conns"`
+	ConnMaxLifetime *duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime *duration `json:"conn_max_idle_time"`
+	SSLMode         *string   `json:"ssl_mode"`
+	SSLRootCert     *string   `json:"ssl_root_cert"`
+}
+
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings such as \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// LoadConfig reads the configuration of the database from the environment,
+// starting from DefaultConfig. If DATABASE_CONFIG_FILE is set, the JSON file
+// it names is read first, and the other variables override it.
+func LoadConfig() (Config, error) {
+	config := DefaultConfig
+	config.URL = os.Getenv("DATABASE_URL")
+
+	if path := os.Getenv("DATABASE_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("invalid DATABASE_CONFIG_FILE: %s", err)
+		}
+		var file configFile
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return config, fmt.Errorf("invalid DATABASE_CONFIG_FILE %s: %s", path, err)
+		}
+
+		if file.QueryTimeout != nil {
+			config.QueryTimeout = time.Duration(*file.QueryTimeout)
+		}
+		if file.StatsInterval != nil {
+			config.StatsInterval = time.Duration(*file.StatsInterval)
+		}
+		if file.ConnMaxLifetime != nil {
+			config.ConnMaxLifetime = time.Duration(*file.ConnMaxLifetime)
+		}
+		if file.ConnMaxIdleTime != nil {
+			config.ConnMaxIdleTime = time.Duration(*file.ConnMaxIdleTime)
+		}
+		if file.MaxOpenConns != nil {
+			config.MaxOpenConns = *file.MaxOpenConns
+		}
+		if file.MaxIdleConns != nil {
+			config.MaxIdleConns = *file.MaxIdleConns
+		}
+		if file.SSLMode != nil {
+			config.SSLMode = *file.SSLMode
+		}
+		if file.SSLRootCert != nil {
+			config.SSLRootCert = *file.SSLRootCert
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DATABASE_QUERY_TIMEOUT":      &config.QueryTimeout,
+		"DATABASE_STATS_INTERVAL":     &config.StatsInterval,
+		"DATABASE_CONN_MAX_LIFETIME":  &config.ConnMaxLifetime,
+		"DATABASE_CONN_MAX_IDLE_TIME": &config.ConnMaxIdleTime,
+	}
+	for name, d := range durations {
+		if s := os.Getenv(name); s != "" {
+			parsed, err := time.ParseDuration(s)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s: %s", name, err)
+			}
+			*d = parsed
+		}
+	}
+
+	ints := map[string]*int{
+		"DATABASE_MAX_OPEN_CONNS": &config.MaxOpenConns,
+		"DATABASE_MAX_IDLE_CONNS": &config.MaxIdleConns,
+	}
+	for name, i := range ints {
+		if s := os.Getenv(name); s != "" {
+			parsed, err := strconv.Atoi(s)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s: %s", name, err)
+			}
+			*i = parsed
+		}
+	}
+
+	if s := os.Getenv("DATABASE_SSL_MODE"); s != "" {
+		config.SSLMode = s
+	}
+	if s := os.Getenv("DATABASE_SSL_ROOT_CERT"); s != "" {
+		config.SSLRootCert = s
+	}
+
+	return config, config.Validate()
+}
+
+// Validate checks the configuration, including that the CA certificates can
+// be read, so that a mistake stops the server from starting rather than
+// surfacing on the first query.
+func (config Config) Validate() error {
+	u, err := url.Parse(config.URL)
+	if config.URL == "" {
+		return errors.New("a database URL is required")
+	}
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return errors.New("the database URL must be a postgres:// URL")
+	}
+
+	if config.QueryTimeout < 0 || config.StatsInterval < 0 || config.ConnMaxLifetime < 0 || config.ConnMaxIdleTime < 0 {
+		return errors.New("database timeouts cannot be negative")
+	}
+	if config.MaxOpenConns < 0 || config.MaxIdleConns < 0 {
+		return errors.New("database connection limits cannot be negative")
+	}
+	if config.MaxOpenConns > 0 && config.MaxIdleConns > config.MaxOpenConns {
+		return fmt.Errorf("max idle connections (%d) cannot be more than max open connections (%d)", config.MaxIdleConns, config.MaxOpenConns)
+	}
+
+	if config.SSLMode != "" && !sslModes[config.SSLMode] {
+		return fmt.Errorf("unknown SSL mode %q, expected disable, require, verify-ca or verify-full", config.SSLMode)
+	}
+	if config.SSLRootCert != "" {
+		if config.SSLMode == "disable" {
+			return errors.New("an SSL root certificate cannot be used with SSL disabled")
+		}
+		data, err := os.ReadFile(config.SSLRootCert)
+		if err != nil {
+			return fmt.Errorf("cannot read SSL root certificate: %s", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			return fmt.Errorf("no PEM encoded certificates in SSL root certificate %s", config.SSLRootCert)
+		}
+	}
+
+	return nil
+}
+
+// connectionString returns the URL with the TLS settings added to it.
+func (config Config) connectionString() string {
+	if config.SSLMode == "" && config.SSLRootCert == "" {
+		return config.URL
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return config.URL
+	}
+	query := u.Query()
+	if config.SSLMode != "" {
+		query.Set("sslmode", config.SSLMode)
+	}
+	if config.SSLRootCert != "" {
+		query.Set("sslrootcert", config.SSLRootCert)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,146 @@
+package database_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/alphagov/paas-accounts/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		for _, name := range []string{
+			"DATABASE_CONFIG_FILE",
+			"DATABASE_QUERY_TIMEOUT",
+			"DATABASE_STATS_INTERVAL",
+			"DATABASE_MAX_OPEN_CONNS",
+			"DATABASE_MAX_IDLE_CONNS",
+			"DATABASE_CONN_MAX_LIFETIME",
+			"DATABASE_CONN_MAX_IDLE_TIME",
+			"DATABASE_SSL_MODE",
+			"DATABASE_SSL_ROOT_CERT",
+		} {
+			GinkgoT().Setenv(name, "")
+		}
+		GinkgoT().Setenv("DATABASE_URL", "postgres://user@localhost:5432/accounts")
+	})
+
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, data, 0600)).To(Succeed())
+		return path
+	}
+
+	It("should start from the defaults", func() {
+		config, err := LoadConfig()
+		Expect(err).ToNot(HaveOccurred())
+
+		expected := DefaultConfig
+		expected.URL = "postgres://user@localhost:5432/accounts"
+		Expect(config).To(Equal(expected))
+	})
+
+	It("should read a config file and let the environment override it", func() {
+		GinkgoT().Setenv("DATABASE_CONFIG_FILE", writeFile("db.json", []byte(`{
+			"max_open_conns": 4,
+			"max_idle_conns": 1,
+			"conn_max_lifetime": "1h",
+			"query_timeout": "3s",
+			"stats_interval": "1m"
+		}`)))
+		GinkgoT().Setenv("DATABASE_QUERY_TIMEOUT", "2s")
+
+		config, err := LoadConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.MaxOpenConns).To(Equal(4))
+		Expect(config.MaxIdleConns).To(Equal(1))
+		Expect(config.ConnMaxLifetime).To(Equal(time.Hour))
+		Expect(config.ConnMaxIdleTime).To(Equal(DefaultConfig.ConnMaxIdleTime))
+		Expect(config.QueryTimeout).To(Equal(2 * time.Second))
+		Expect(config.StatsInterval).To(Equal(time.Minute))
+	})
+
+	It("should reject a config file with unknown settings", func() {
+		GinkgoT().Setenv("DATABASE_CONFIG_FILE", writeFile("db.json", []byte(`{"max_conns": 4}`)))
+
+		_, err := LoadConfig()
+		Expect(err).To(MatchError(ContainSubstring("max_conns")))
+	})
+
+	It("should reject a duration that can't be parsed", func() {
+		GinkgoT().Setenv("DATABASE_CONN_MAX_LIFETIME", "forever")
+
+		_, err := LoadConfig()
+		Expect(err).To(MatchError(ContainSubstring("invalid DATABASE_CONN_MAX_LIFETIME")))
+	})
+
+	It("should accept a file of CA certificates", func() {
+		GinkgoT().Setenv("DATABASE_SSL_MODE", "verify-full")
+		GinkgoT().Setenv("DATABASE_SSL_ROOT_CERT", writeFile("rds-ca.pem", selfSignedCertificate()))
+
+		config, err := LoadConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.SSLMode).To(Equal("verify-full"))
+
+		db, err := Open(config)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.Close()).To(Succeed())
+	})
+
+	DescribeTable("should reject invalid config",
+		func(change func(*Config), message string) {
+			config := DefaultConfig
+			config.URL = "postgres://user@localhost:5432/accounts"
+			change(&config)
+
+			Expect(config.Validate()).To(MatchError(ContainSubstring(message)))
+			_, err := Open(config)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("no URL", func(c *Config) { c.URL = "" }, "a database URL is required"),
+		Entry("not a URL", func(c *Config) { c.URL = "host=localhost" }, "must be a postgres:// URL"),
+		Entry("negative timeout", func(c *Config) { c.QueryTimeout = -time.Second }, "cannot be negative"),
+		Entry("negative stats interval", func(c *Config) { c.StatsInterval = -time.Second }, "cannot be negative"),
+		Entry("negative connections", func(c *Config) { c.MaxOpenConns = -1 }, "cannot be negative"),
+		Entry("more idle than open connections", func(c *Config) { c.MaxIdleConns = 10 }, "max idle connections (10)"),
+		Entry("unknown SSL mode", func(c *Config) { c.SSLMode = "verify" }, `unknown SSL mode "verify"`),
+		Entry("missing CA file", func(c *Config) { c.SSLRootCert = "/does/not/exist.pem" }, "cannot read SSL root certificate"),
+		Entry("CA file without certificates", func(c *Config) { c.SSLRootCert = "config_test.go" }, "no PEM encoded certificates"),
+		Entry("CA file with SSL disabled", func(c *Config) {
+			c.SSLMode = "disable"
+			c.SSLRootCert = "config_test.go"
+		}, "cannot be used with SSL disabled"),
+	)
+})
+
+func selfSignedCertificate() []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,14 @@
+package database_test
+
+import (
+	. "github.com/alphagov/paas-accounts/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ContentHash", func() {
+	It("should return the hex encoded SHA-256 of the content", func() {
+		Expect(ContentHash("hello")).To(Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+	})
+})
@@ -1,24 +1,35 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
 	"errors"
 	"strings"
 	"time"
 
 	"fmt"
 
-	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type User struct {
-	UUID     string  `json:"user_uuid" validate:"uuid"`
-	Email    *string `json:"user_email" validate:"omitempty,email"`
-	Username *string `json:"username" validate:"required,min=1"`
+	UUID     string     `json:"user_uuid" validate:"uuid"`
+	Email    *string    `json:"user_email" validate:"omitempty,email"`
+	Username *string    `json:"username" validate:"required,min=1"`
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
+}
+
+// Erasure records that the personal data held about a user was erased, and
+// who asked for it.
+type Erasure struct {
+	UserUUID  string    `json:"user_uuid"`
+	Date      time.Time `json:"date"`
+	Principal *string   `json:"principal,omitempty"`
 }
 
 type Document struct {
@@ -27,81 +38,210 @@ type Document struct {
 	ValidFrom time.Time `json:"valid_from"`
 }
 
+type DocumentSummary struct {
+	Name         string    `json:"name"`
+	ValidFrom    time.Time `json:"valid_from"`
+	VersionCount int       `json:"version_count"`
+	ContentHash  string    `json:"content_hash"`
+}
+
+type DocumentVersion struct {
+	Name           string    `json:"name"`
+	Version        int       `json:"version"`
+	Content        string    `json:"content"`
+	ValidFrom      time.Time `json:"valid_from"`
+	ContentHash    string    `json:"content_hash"`
+	AgreementCount int       `json:"agreement_count"`
+}
+
 type Agreement struct {
+	UserUUID            string     `json:"user_uuid"`
+	DocumentName        string     `json:"document_name"`
+	Date                time.Time  `json:"date"`
+	DocumentValidFrom   *time.Time `json:"document_valid_from,omitempty"`
+	DocumentContentHash *string    `json:"document_content_hash,omitempty"`
+	Provenance
+}
+
+// Provenance records who submitted an agreement and where it came from.
+// Agreements made before provenance was recorded have none.
+type Provenance struct {
+	Principal *string `json:"principal,omitempty"`
+	Channel   *string `json:"channel,omitempty"`
+	ClientIP  *string `json:"client_ip,omitempty"`
+	UserAgent *string `json:"user_agent,omitempty"`
+}
+
+func (p Provenance) recorded() bool {
+	return p.Principal != nil || p.Channel != nil || p.ClientIP != nil || p.UserAgent != nil
+}
+
+type Revocation struct {
 	UserUUID     string    `json:"user_uuid"`
 	DocumentName string    `json:"document_name"`
 	Date         time.Time `json:"date"`
+	Reason       *string   `json:"reason,omitempty"`
+}
+
+type AgreementFilter struct {
+	DocumentName string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+	Offset       int
 }
 
 type UserDocument struct {
-	Name          string     `json:"name"`
-	Content       string     `json:"content"`
-	ValidFrom     time.Time  `json:"valid_from"`
-	AgreementDate *time.Time `json:"agreement_date"`
+	Name                string      `json:"name"`
+	Content             string      `json:"content"`
+	ValidFrom           time.Time   `json:"valid_from"`
+	Upcoming            bool        `json:"upcoming"`
+	AgreementDate       *time.Time  `json:"agreement_date"`
+	AgreementProvenance *Provenance `json:"agreement_provenance,omitempty"`
 }
 
 var (
 	//go:embed sql/*.sql
 	sqlFs embed.FS
 
-	ErrDocumentNotFound = errors.New("document not found")
-	ErrUserNotFound     = errors.New("user not found")
+	ErrDocumentNotFound        = errors.New("document not found")
+	ErrDocumentHistoryConflict = errors.New("cannot_alter_document_history")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrAgreementNotFound       = errors.New("agreement not found")
 )
 
+// validDocumentsQuery annotates every document version with its ordinal
+// version number and the range of time for which it was the latest version.
+const validDocumentsQuery = `
+	SELECT
+		*,
+		row_number() over (
+			partition by name order by valid_from
+		) as version,
+		tstzrange(valid_from, lead(valid_from, 1, 'infinity') over (
+			partition by name order by valid_from rows between current row and 1 following
+		)) as valid_for
+	FROM
+		documents
+`
+
+// agreementAppliesToVersion matches an agreement to the document version (d)
+// it was made against. Agreements that name a version apply to that version,
+// which may have been upcoming at the time, otherwise they apply to whichever
+// version was the latest on the date of the agreement. Agreements that have
+// since been revoked do not apply to any version.
+const agreementAppliesToVersion = `
+	d.name = agreements.document_name
+	AND (
+		agreements.document_valid_from = d.valid_from
+		OR (agreements.document_valid_from IS NULL AND agreements.date <@ d.valid_for)
+	)
+	AND NOT EXISTS (
+		SELECT
+			1
+		FROM
+			agreement_revocations r
+		WHERE
+			r.user_uuid = agreements.user_uuid
+			AND r.document_name = agreements.document_name
+			AND r.date >= agreements.date
+	)
+`
+
 type DB struct {
-	conn    *sql.DB
-	connstr string
+	conn          *sql.DB
+	connstr       string
+	queryTimeout  time.Duration
+	statsInterval time.Duration
+	queryDuration *prometheus.HistogramVec
 }
 
 func NewDB(connstr string) (*DB, error) {
+	return Open(Config{URL: connstr})
+}
+
+// Open creates a DB from a Config, returning an error if the Config is
+// invalid. Like sql.Open, it does not connect to Postgres until the DB is
+// first used.
+func Open(config Config) (*DB, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	connstr := config.connectionString()
 	conn, err := sql.Open("postgres", connstr)
 	if err != nil {
 		return nil, err
 	}
-
-	return &DB{conn: conn, connstr: connstr}, nil
+	conn.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns > 0 {
+		conn.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	conn.SetConnMaxLifetime(config.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	return &DB{
+		conn:          conn,
+		connstr:       connstr,
+		queryTimeout:  config.QueryTimeout,
+		statsInterval: config.StatsInterval,
+		queryDuration: newQueryDuration(),
+	}, nil
 }
 
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// Init migrates the database to the newest migration.
 func (db *DB) Init() error {
-	sourceDriver, err := iofs.New(sqlFs, "sql")
-	if err != nil {
-		return err
-	}
+	return db.MigrateUp()
+}
 
-	m, err := migrate.NewWithSourceInstance("iofs", sourceDriver, db.connstr)
-	if err != nil {
+// PutDocument stores a new version of a document, unless its content matches
+// the latest version, including any version scheduled for the future.
+func (db *DB) PutDocument(ctx context.Context, doc Document) (err error) {
+	ctx, end := db.begin(ctx, "PutDocument")
+	defer end(&err)
+
+	latestDocVersion, err := db.getLatestDocument(ctx, doc.Name)
+	if err != nil && err != ErrDocumentNotFound {
 		return err
 	}
 
-	defer m.Close()
-	if err := m.Up(); err != migrate.ErrNoChange {
-		return err
+	if err == ErrDocumentNotFound || latestDocVersion.Content != doc.Content {
+		_, err = db.conn.ExecContext(ctx, `INSERT INTO documents (name, content, valid_from) VALUES ($1, $2, $3)`, doc.Name, doc.Content, doc.ValidFrom)
+		return translateError(err)
 	}
 
 	return nil
 }
 
-func (db *DB) PutDocument(doc Document) error {
-	latestDocVersion, err := db.GetDocument(doc.Name)
-	if err != nil && err != ErrDocumentNotFound {
-		return err
-	}
+// GetDocument returns the version of a document that is currently in force,
+// ignoring any version scheduled for the future.
+func (db *DB) GetDocument(ctx context.Context, name string) (_ Document, err error) {
+	ctx, end := db.begin(ctx, "GetDocument")
+	defer end(&err)
 
-	if err == ErrDocumentNotFound || latestDocVersion.Content != doc.Content {
-		_, err = db.conn.Exec(`INSERT INTO documents (name, content, valid_from) VALUES ($1, $2, $3)`, doc.Name, doc.Content, doc.ValidFrom)
-		return err
-	}
+	return db.queryDocument(ctx, `SELECT name, content, valid_from FROM documents WHERE name = $1 AND valid_from <= now() ORDER BY valid_from DESC LIMIT 1`, name)
+}
 
-	return nil
+// GetUpcomingDocument returns the next version of a document that is
+// scheduled to come into force.
+func (db *DB) GetUpcomingDocument(ctx context.Context, name string) (_ Document, err error) {
+	ctx, end := db.begin(ctx, "GetUpcomingDocument")
+	defer end(&err)
+
+	return db.queryDocument(ctx, `SELECT name, content, valid_from FROM documents WHERE name = $1 AND valid_from > now() ORDER BY valid_from ASC LIMIT 1`, name)
+}
+
+func (db *DB) getLatestDocument(ctx context.Context, name string) (Document, error) {
+	return db.queryDocument(ctx, `SELECT name, content, valid_from FROM documents WHERE name = $1 ORDER BY valid_from DESC LIMIT 1`, name)
 }
 
-func (db *DB) GetDocument(name string) (Document, error) {
+func (db *DB) queryDocument(ctx context.Context, query string, name string) (Document, error) {
 	doc := Document{}
-	err := db.conn.QueryRow(`SELECT name, content, valid_from FROM documents WHERE name = $1 ORDER BY valid_from DESC LIMIT 1`, name).Scan(&doc.Name, &doc.Content, &doc.ValidFrom)
+	err := db.conn.QueryRowContext(ctx, query, name).Scan(&doc.Name, &doc.Content, &doc.ValidFrom)
 
 	if err == sql.ErrNoRows {
 		err = ErrDocumentNotFound
@@ -110,24 +250,310 @@ func (db *DB) GetDocument(name string) (Document, error) {
 	return doc, err
 }
 
-func (db *DB) PostUser(user User) error {
-	_, err := db.GetUser(user.UUID)
-	if err == ErrUserNotFound {
-		_, err = db.conn.Exec(`INSERT INTO users (uuid, email, username) VALUES ($1, $2, $3)`, user.UUID, lowerStrPoint(user.Email), user.Username)
+// GetDocuments summarises the latest version of every document, including
+// versions scheduled for the future. When updatedSince is set only documents
+// with a version newer than it are returned.
+func (db *DB) GetDocuments(ctx context.Context, updatedSince *time.Time) (_ []DocumentSummary, err error) {
+	ctx, end := db.begin(ctx, "GetDocuments")
+	defer end(&err)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT
+			name, content_hash, valid_from, version_count
+		FROM (
+			SELECT DISTINCT ON (name)
+				name,
+				content_hash,
+				valid_from,
+				count(*) over (partition by name) as version_count
+			FROM
+				documents
+			ORDER BY
+				name, valid_from DESC
+		) latest
+		WHERE
+			$1::timestamptz IS NULL OR valid_from > $1::timestamptz
+		ORDER BY
+			name
+	`, updatedSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	documents := []DocumentSummary{}
+	for rows.Next() {
+		var document DocumentSummary
+		err := rows.Scan(&document.Name, &document.ContentHash, &document.ValidFrom, &document.VersionCount)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, rows.Err()
+}
+
+// GetDocumentVersions returns every version of a document, oldest first,
+// along with the number of users who agreed to each version.
+func (db *DB) GetDocumentVersions(ctx context.Context, name string) (_ []DocumentVersion, err error) {
+	ctx, end := db.begin(ctx, "GetDocumentVersions")
+	defer end(&err)
+
+	versions, err := db.queryDocumentVersions(ctx, `d.name = $1`, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+
+	return versions, nil
+}
+
+// GetDocumentVersion returns a document by its ordinal version number,
+// starting from 1 for the first version.
+func (db *DB) GetDocumentVersion(ctx context.Context, name string, version int) (_ DocumentVersion, err error) {
+	ctx, end := db.begin(ctx, "GetDocumentVersion")
+	defer end(&err)
+
+	return db.queryDocumentVersion(ctx, `d.name = $1 AND d.version = $2`, name, version)
+}
+
+// GetDocumentVersionAt returns the version of a document that was the latest
+// version at the given time.
+func (db *DB) GetDocumentVersionAt(ctx context.Context, name string, at time.Time) (_ DocumentVersion, err error) {
+	ctx, end := db.begin(ctx, "GetDocumentVersionAt")
+	defer end(&err)
+
+	return db.queryDocumentVersion(ctx, `d.name = $1 AND d.valid_for @> $2::timestamptz`, name, at)
+}
+
+func (db *DB) queryDocumentVersion(ctx context.Context, condition string, args ...interface{}) (DocumentVersion, error) {
+	versions, err := db.queryDocumentVersions(ctx, condition, args...)
+	if err != nil {
+		return DocumentVersion{}, err
+	}
+
+	if len(versions) == 0 {
+		return DocumentVersion{}, ErrDocumentNotFound
+	}
+
+	return versions[0], nil
+}
+
+func (db *DB) queryDocumentVersions(ctx context.Context, condition string, args ...interface{}) ([]DocumentVersion, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		WITH valid_documents AS (`+validDocumentsQuery+`)
+		SELECT
+			d.name,
+			d.version,
+			d.content,
+			d.valid_from,
+			d.content_hash,
+			count(DISTINCT agreements.user_uuid)
+		FROM
+			valid_documents d
+		LEFT JOIN
+			agreements ON (`+agreementAppliesToVersion+`)
+		WHERE
+			`+condition+`
+		GROUP BY
+			d.name, d.version, d.content, d.valid_from, d.content_hash
+		ORDER BY
+			d.valid_from
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := []DocumentVersion{}
+	for rows.Next() {
+		var version DocumentVersion
+		err := rows.Scan(&version.Name, &version.Version, &version.Content, &version.ValidFrom, &version.ContentHash, &version.AgreementCount)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetUsersWithOutstandingDocument returns every user, ordered by UUID, who
+// has not agreed to the version of a document currently in force. Erased
+// users are left out. A zero limit returns every user.
+func (db *DB) GetUsersWithOutstandingDocument(ctx context.Context, name string, limit int, offset int) (_ []User, err error) {
+	ctx, end := db.begin(ctx, "GetUsersWithOutstandingDocument")
+	defer end(&err)
+
+	if _, err := db.GetDocument(ctx, name); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{name}
+	query := `
+		WITH valid_documents AS (` + validDocumentsQuery + `)
+		SELECT
+			u.uuid, u.email, u.username, u.erased_at
+		FROM
+			users u
+		JOIN
+			valid_documents d ON (
+				d.name = $1
+				AND d.valid_for @> now()
+			)
+		WHERE
+			u.erased_at IS NULL
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					agreements
+				WHERE
+					agreements.user_uuid = u.uuid
+					AND ` + agreementAppliesToVersion + `
+			)
+		ORDER BY
+			u.uuid
+	`
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if offset > 0 {
+		args = append(args, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.UUID, &user.Email, &user.Username, &user.ErasedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// PostUser creates a user if no user with the same UUID exists, and
+// otherwise does nothing.
+func (db *DB) PostUser(ctx context.Context, user User) (err error) {
+	ctx, end := db.begin(ctx, "PostUser")
+	defer end(&err)
+
+	_, err = db.conn.ExecContext(ctx, `
+		INSERT INTO users (uuid, email, username) VALUES ($1, $2, $3)
+		ON CONFLICT (uuid) DO NOTHING
+	`, user.UUID, lowerStrPoint(user.Email), user.Username)
+	return translateError(err)
+}
+
+// CreateUser creates a new user. It returns ErrUserExists if a user with the
+// same UUID exists, or ErrUsernameTaken if another user has the username.
+func (db *DB) CreateUser(ctx context.Context, user User) (err error) {
+	ctx, end := db.begin(ctx, "CreateUser")
+	defer end(&err)
+
+	_, err = db.conn.ExecContext(ctx, `INSERT INTO users (uuid, email, username) VALUES ($1, $2, $3)`, user.UUID, lowerStrPoint(user.Email), user.Username)
+	return translateError(err)
+}
+
+func (db *DB) PatchUser(ctx context.Context, user User) (err error) {
+	ctx, end := db.begin(ctx, "PatchUser")
+	defer end(&err)
+
+	_, err = db.conn.ExecContext(ctx, `UPDATE users SET email = $2, username = $3 WHERE uuid = $1`, user.UUID, lowerStrPoint(user.Email), user.Username)
+	return translateError(err)
+}
+
+// EraseUser removes the email address and username of a user, the IP
+// address and user agent recorded with their agreements and the reasons given
+// for their revocations, and records the erasure. The user's UUID is kept so
+// their agreements and revocations stay linked to them. Erasing a user who
+// has already been erased does nothing.
+func (db *DB) EraseUser(ctx context.Context, uuid string, principal *string) (_ User, err error) {
+	ctx, end := db.begin(ctx, "EraseUser")
+	defer end(&err)
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		var erasedAt time.Time
+		err := tx.QueryRowContext(ctx, `
+			UPDATE users SET email = NULL, username = NULL, erased_at = now()
+			WHERE uuid = $1 AND erased_at IS NULL
+			RETURNING erased_at
+		`, uuid).Scan(&erasedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return translateError(err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_erasures (user_uuid, date, principal) VALUES ($1, $2, $3)
+		`, uuid, erasedAt, principal)
+		if err != nil {
+			return translateError(err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE agreements SET client_ip = NULL, user_agent = NULL
+			WHERE user_uuid = $1 AND (client_ip IS NOT NULL OR user_agent IS NOT NULL)
+		`, uuid)
+		if err != nil {
+			return translateError(err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE agreement_revocations SET reason = NULL
+			WHERE user_uuid = $1 AND reason IS NOT NULL
+		`, uuid)
+		return translateError(err)
+	})
+	if err != nil {
+		return User{}, err
 	}
-	return err
+
+	return db.GetUser(ctx, uuid)
 }
 
-func (db *DB) PatchUser(user User) error {
-	_, err := db.conn.Exec(`UPDATE users SET email = $2, username = $3 WHERE uuid = $1`, user.UUID, lowerStrPoint(user.Email), user.Username)
-	return err
+// GetErasure returns the erasure of a user, or nil if they have not been
+// erased.
+func (db *DB) GetErasure(ctx context.Context, uuid string) (_ *Erasure, err error) {
+	ctx, end := db.begin(ctx, "GetErasure")
+	defer end(&err)
+
+	erasure := Erasure{}
+	err = db.conn.QueryRowContext(ctx, `
+		SELECT user_uuid, date, principal FROM user_erasures WHERE user_uuid = $1
+	`, uuid).Scan(&erasure.UserUUID, &erasure.Date, &erasure.Principal)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &erasure, nil
 }
 
-func (db *DB) GetUser(uuid string) (User, error) {
+func (db *DB) GetUser(ctx context.Context, uuid string) (_ User, err error) {
+	ctx, end := db.begin(ctx, "GetUser")
+	defer end(&err)
+
 	user := User{}
-	err := db.conn.QueryRow(`
-		SELECT uuid, email, username FROM users WHERE uuid = $1
-	`, uuid).Scan(&user.UUID, &user.Email, &user.Username)
+	err = db.conn.QueryRowContext(ctx, `
+		SELECT uuid, email, username, erased_at FROM users WHERE uuid = $1
+	`, uuid).Scan(&user.UUID, &user.Email, &user.Username, &user.ErasedAt)
 
 	if err == sql.ErrNoRows {
 		err = ErrUserNotFound
@@ -136,25 +562,23 @@ func (db *DB) GetUser(uuid string) (User, error) {
 	return user, err
 }
 
-func (db *DB) GetUserByEmail(email string) ([]*User, error) {
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (_ []*User, err error) {
+	ctx, end := db.begin(ctx, "GetUserByEmail")
+	defer end(&err)
+
 	var users []*User
-	rows, err := db.conn.Query(`
-		SELECT uuid, email, username FROM users WHERE email = $1
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT uuid, email, username, erased_at FROM users WHERE email = $1
 	`, email)
-
-	defer rows.Close()
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return users, nil
-		}
-
 		return users, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.UUID, &user.Email, &user.Username)
+		err := rows.Scan(&user.UUID, &user.Email, &user.Username, &user.ErasedAt)
 		if err != nil {
 			return users, err
 		}
@@ -162,14 +586,17 @@ func (db *DB) GetUserByEmail(email string) ([]*User, error) {
 		users = append(users, &user)
 	}
 
-	return users, err
+	return users, rows.Err()
 }
 
-func (db *DB) GetUserByUsername(username string) (User, error) {
+func (db *DB) GetUserByUsername(ctx context.Context, username string) (_ User, err error) {
+	ctx, end := db.begin(ctx, "GetUserByUsername")
+	defer end(&err)
+
 	user := User{}
-	err := db.conn.QueryRow(`
-		SELECT uuid, email, username FROM users WHERE username = $1
-	`, username).Scan(&user.UUID, &user.Email, &user.Username)
+	err = db.conn.QueryRowContext(ctx, `
+		SELECT uuid, email, username, erased_at FROM users WHERE username = $1
+	`, username).Scan(&user.UUID, &user.Email, &user.Username, &user.ErasedAt)
 
 	if err == sql.ErrNoRows {
 		err = ErrUserNotFound
@@ -178,7 +605,9 @@ func (db *DB) GetUserByUsername(username string) (User, error) {
 	return user, err
 }
 
-func (db *DB) GetUsersByUUID(uuids []string) ([]*User, error) {
+func (db *DB) GetUsersByUUID(ctx context.Context, uuids []string) (_ []*User, err error) {
+	ctx, end := db.begin(ctx, "GetUsersByUUID")
+	defer end(&err)
 
 	users := []*User{}
 
@@ -196,9 +625,9 @@ func (db *DB) GetUsersByUUID(uuids []string) ([]*User, error) {
 		f.WriteString(fmt.Sprintf("$%v,", i+1))
 	}
 	fragment := strings.TrimSuffix(f.String(), ",")
-	query := strings.Replace(`SELECT uuid, email, username FROM users WHERE uuid IN (uuids)`, "uuids", fragment, -1)
+	query := strings.Replace(`SELECT uuid, email, username, erased_at FROM users WHERE uuid IN (uuids)`, "uuids", fragment, -1)
 
-	rows, err := db.conn.Query(query, uuidsCopy...)
+	rows, err := db.conn.QueryContext(ctx, query, uuidsCopy...)
 	if err != nil {
 		return users, err
 	}
@@ -209,7 +638,7 @@ func (db *DB) GetUsersByUUID(uuids []string) ([]*User, error) {
 	uuidToUser := map[string]*User{}
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.UUID, &user.Email, &user.Username)
+		err := rows.Scan(&user.UUID, &user.Email, &user.Username, &user.ErasedAt)
 		if err != nil {
 			return users, err
 		}
@@ -230,40 +659,73 @@ func (db *DB) GetUsersByUUID(uuids []string) ([]*User, error) {
 	return users, nil
 }
 
-func (db *DB) PutAgreement(agreement Agreement) error {
-	_, err := db.conn.Exec(`
+func (db *DB) PutAgreement(ctx context.Context, agreement Agreement) (err error) {
+	ctx, end := db.begin(ctx, "PutAgreement")
+	defer end(&err)
+
+	return putAgreement(ctx, db.conn, agreement)
+}
+
+// PutAgreementForUser records an agreement, creating the user if they do not
+// already exist. Both happen in a single transaction, so a rejected agreement
+// does not leave a new user behind.
+func (db *DB) PutAgreementForUser(ctx context.Context, agreement Agreement) (err error) {
+	ctx, end := db.begin(ctx, "PutAgreementForUser")
+	defer end(&err)
+
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (uuid) VALUES ($1) ON CONFLICT (uuid) DO NOTHING`, agreement.UserUUID)
+		if err != nil {
+			return translateError(err)
+		}
+
+		return putAgreement(ctx, tx, agreement)
+	})
+}
+
+func putAgreement(ctx context.Context, conn execer, agreement Agreement) error {
+	_, err := conn.ExecContext(ctx, `
 		INSERT INTO agreements (
-			user_uuid, document_name, date
+			`+agreementColumns+`
 		) VALUES (
-			$1, $2, $3
+			$1, $2, $3, $4, $5, $6, $7, $8, $9
 		)
-	`, agreement.UserUUID, agreement.DocumentName, agreement.Date)
-
-	return err
+	`,
+		agreement.UserUUID,
+		agreement.DocumentName,
+		agreement.Date,
+		agreement.DocumentValidFrom,
+		agreement.DocumentContentHash,
+		agreement.Principal,
+		agreement.Channel,
+		agreement.ClientIP,
+		agreement.UserAgent,
+	)
+
+	return translateError(err)
 }
 
-func (db *DB) GetDocumentsForUserUUID(uuid string) ([]UserDocument, error) {
-	rows, err := db.conn.Query(`
-		WITH valid_documents AS (
-			SELECT
-				*,
-				tstzrange(valid_from, lead(valid_from, 1, 'infinity') over (
-						partition by name order by valid_from rows between current row and 1 following
-				)) as valid_for
-			FROM
-				documents
-		)
+func (db *DB) GetDocumentsForUserUUID(ctx context.Context, uuid string) (_ []UserDocument, err error) {
+	ctx, end := db.begin(ctx, "GetDocumentsForUserUUID")
+	defer end(&err)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		WITH valid_documents AS (`+validDocumentsQuery+`)
 		SELECT
 			d.name,
 			d.content,
 			d.valid_from,
-			agreements.date
+			d.valid_from > now(),
+			agreements.date,
+			agreements.principal,
+			agreements.channel,
+			agreements.client_ip,
+			agreements.user_agent
 		FROM
 			valid_documents d
 		LEFT JOIN
 			agreements ON (
-				d.name = agreements.document_name
-				AND agreements.date <@ d.valid_for
+				`+agreementAppliesToVersion+`
 				AND agreements.user_uuid = $1
 			)
 		ORDER BY
@@ -277,22 +739,39 @@ func (db *DB) GetDocumentsForUserUUID(uuid string) ([]UserDocument, error) {
 	for rows.Next() {
 		var userDocument UserDocument
 		var nullTime pq.NullTime
-		err := rows.Scan(&userDocument.Name, &userDocument.Content, &userDocument.ValidFrom, &nullTime)
+		var provenance Provenance
+		err := rows.Scan(
+			&userDocument.Name,
+			&userDocument.Content,
+			&userDocument.ValidFrom,
+			&userDocument.Upcoming,
+			&nullTime,
+			&provenance.Principal,
+			&provenance.Channel,
+			&provenance.ClientIP,
+			&provenance.UserAgent,
+		)
 		if err != nil {
 			return nil, err
 		}
 		if nullTime.Valid {
 			userDocument.AgreementDate = &nullTime.Time
 		}
+		if provenance.recorded() {
+			userDocument.AgreementProvenance = &provenance
+		}
 		userDocuments = append(userDocuments, userDocument)
 	}
 	return userDocuments, nil
 }
 
-func (db *DB) GetAgreementsForUserUUID(uuid string) ([]Agreement, error) {
-	rows, err := db.conn.Query(`
+func (db *DB) GetAgreementsForUserUUID(ctx context.Context, uuid string) (_ []Agreement, err error) {
+	ctx, end := db.begin(ctx, "GetAgreementsForUserUUID")
+	defer end(&err)
+
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT
-			user_uuid, document_name, date
+			`+agreementColumns+`
 		FROM
 			agreements
 		WHERE
@@ -304,21 +783,196 @@ func (db *DB) GetAgreementsForUserUUID(uuid string) ([]Agreement, error) {
 		return nil, err
 	}
 	defer rows.Close()
+
+	return scanAgreements(rows)
+}
+
+// FilterAgreementsForUserUUID returns the raw agreement history for a user,
+// restricted to a document name and to the half-open date range [From, To)
+// when those are set. A zero Limit returns every matching agreement.
+func (db *DB) FilterAgreementsForUserUUID(ctx context.Context, uuid string, filter AgreementFilter) (_ []Agreement, err error) {
+	ctx, end := db.begin(ctx, "FilterAgreementsForUserUUID")
+	defer end(&err)
+
+	conditions := []string{"user_uuid = $1"}
+	args := []interface{}{uuid}
+
+	if filter.DocumentName != "" {
+		args = append(args, filter.DocumentName)
+		conditions = append(conditions, fmt.Sprintf("document_name = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("date >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("date < $%d", len(args)))
+	}
+
+	query := `
+		SELECT
+			` + agreementColumns + `
+		FROM
+			agreements
+		WHERE
+			` + strings.Join(conditions, " AND ") + `
+		ORDER BY
+			date, document_name
+	`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAgreements(rows)
+}
+
+// agreementColumns lists the columns of the agreements table in the order
+// scanAgreements expects them.
+const agreementColumns = `
+	user_uuid,
+	document_name,
+	date,
+	document_valid_from,
+	document_content_hash,
+	principal,
+	channel,
+	client_ip,
+	user_agent
+`
+
+func scanAgreements(rows *sql.Rows) ([]Agreement, error) {
 	agreements := []Agreement{}
 	for rows.Next() {
 		var agreement Agreement
-		err := rows.Scan(&agreement.UserUUID, &agreement.DocumentName, &agreement.Date)
+		err := rows.Scan(
+			&agreement.UserUUID,
+			&agreement.DocumentName,
+			&agreement.Date,
+			&agreement.DocumentValidFrom,
+			&agreement.DocumentContentHash,
+			&agreement.Principal,
+			&agreement.Channel,
+			&agreement.ClientIP,
+			&agreement.UserAgent,
+		)
 		if err != nil {
 			return nil, err
 		}
 		agreements = append(agreements, agreement)
 	}
 
-	return agreements, nil
+	return agreements, rows.Err()
+}
+
+// PutRevocation records that a user has withdrawn their agreement to a
+// document. Every agreement to the document made before the revocation is
+// treated as revoked, but the agreements themselves are left untouched.
+func (db *DB) PutRevocation(ctx context.Context, revocation Revocation) (err error) {
+	ctx, end := db.begin(ctx, "PutRevocation")
+	defer end(&err)
+
+	_, err = db.conn.ExecContext(ctx, `
+		INSERT INTO agreement_revocations (
+			user_uuid, document_name, date, reason
+		) VALUES (
+			$1, $2, $3, $4
+		)
+	`, revocation.UserUUID, revocation.DocumentName, revocation.Date, revocation.Reason)
+
+	return translateError(err)
+}
+
+func (db *DB) GetRevocationsForUserUUID(ctx context.Context, uuid string) (_ []Revocation, err error) {
+	ctx, end := db.begin(ctx, "GetRevocationsForUserUUID")
+	defer end(&err)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT
+			user_uuid, document_name, date, reason
+		FROM
+			agreement_revocations
+		WHERE
+			user_uuid = $1
+		ORDER BY
+			date
+	`, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revocations := []Revocation{}
+	for rows.Next() {
+		var revocation Revocation
+		err := rows.Scan(&revocation.UserUUID, &revocation.DocumentName, &revocation.Date, &revocation.Reason)
+		if err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+
+	return revocations, rows.Err()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// begin starts a call to a method of DB, applying the query timeout to ctx.
+// Defer the function it returns with a pointer to the method's error, which
+// records how long the method took and reports a query that was cancelled or
+// ran out of time as ErrCanceled or ErrTimeout:
+//
+//	ctx, end := db.begin(ctx, "GetUser")
+//	defer end(&err)
+func (db *DB) begin(ctx context.Context, method string) (context.Context, func(*error)) {
+	start := time.Now()
+	cancel := func() {}
+	if db.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, db.queryTimeout)
+	}
+
+	return ctx, func(err *error) {
+		*err = contextError(ctx, *err)
+		cancel()
+		db.observe(method, start)
+	}
+}
+
+func (db *DB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
 }
 
-func (db *DB) Ping() error {
-	return db.conn.Ping()
+// ContentHash returns the hex encoded SHA-256 hash of a document's content.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
 
 func lowerStrPoint(str *string) *string {
@@ -1,6 +1,8 @@
 package database_test
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -12,6 +14,9 @@ func TestDb(t *testing.T) {
 	RunSpecs(t, "Db Suite")
 }
 
+// ctx is passed to every method of the stores under test.
+var ctx = context.Background()
+
 func strPoint(str string) *string {
 	return &str
 }
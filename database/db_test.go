@@ -1,9 +1,12 @@
 package database_test
 
 import (
+	"context"
+	"database/sql"
 	"time"
 
 	. "github.com/alphagov/paas-accounts/database"
+	"github.com/prometheus/client_golang/prometheus"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -46,10 +49,10 @@ var _ = Describe("DB", func() {
 				ValidFrom: frozenTime,
 			}
 
-			err := db.PutDocument(input)
+			err := db.PutDocument(ctx, input)
 			Expect(err).ToNot(HaveOccurred())
 
-			doc, err := db.GetDocument(input.Name)
+			doc, err := db.GetDocument(ctx, input.Name)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Name).To(Equal(input.Name))
 			Expect(doc.Content).To(Equal(input.Content))
@@ -63,7 +66,7 @@ var _ = Describe("DB", func() {
 				ValidFrom: frozenTime,
 			}
 
-			err := db.PutDocument(input)
+			err := db.PutDocument(ctx, input)
 			Expect(err).To(MatchError(ContainSubstring("documents_name_check")))
 		})
 
@@ -74,8 +77,9 @@ var _ = Describe("DB", func() {
 				ValidFrom: frozenTime,
 			}
 
-			err := db.PutDocument(input)
+			err := db.PutDocument(ctx, input)
 			Expect(err).To(MatchError(ContainSubstring("documents_content_check")))
+			Expect(err).To(MatchError(ErrInvalidInput))
 		})
 
 		It("should fail to put a document without valid_from", func() {
@@ -84,7 +88,7 @@ var _ = Describe("DB", func() {
 				Content: "some-content",
 			}
 
-			err := db.PutDocument(input)
+			err := db.PutDocument(ctx, input)
 			Expect(err).To(MatchError(ContainSubstring("documents_valid_from_check")))
 		})
 
@@ -100,8 +104,8 @@ var _ = Describe("DB", func() {
 				ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
 			}
 
-			Expect(db.PutDocument(doc1)).To(Succeed())
-			Expect(db.PutDocument(doc2)).To(MatchError(ContainSubstring("cannot_alter_document_history")))
+			Expect(db.PutDocument(ctx, doc1)).To(Succeed())
+			Expect(db.PutDocument(ctx, doc2)).To(MatchError(ContainSubstring("cannot_alter_document_history")))
 		})
 
 		It("should not update a document if the content matches the latest version", func() {
@@ -118,15 +122,127 @@ var _ = Describe("DB", func() {
 				ValidFrom: secondDate,
 			}
 
-			Expect(db.PutDocument(doc1)).To(Succeed())
-			Expect(db.PutDocument(doc2)).To(Succeed())
+			Expect(db.PutDocument(ctx, doc1)).To(Succeed())
+			Expect(db.PutDocument(ctx, doc2)).To(Succeed())
 
-			latestVersion, err := db.GetDocument("document")
+			latestVersion, err := db.GetDocument(ctx, "document")
 			Expect(err).NotTo(HaveOccurred())
 			Expect(latestVersion.ValidFrom).To(BeTemporally("==", firstDate))
 		})
 	})
 
+	Describe("Scheduled documents", func() {
+		var (
+			currentVersion, upcomingVersion Document
+			user                            User
+		)
+
+		BeforeEach(func() {
+			currentVersion = Document{
+				Name:      "document",
+				Content:   "current content",
+				ValidFrom: frozenTime,
+			}
+			upcomingVersion = Document{
+				Name:      "document",
+				Content:   "upcoming content",
+				ValidFrom: time.Now().Add(24 * time.Hour),
+			}
+			Expect(db.PutDocument(ctx, currentVersion)).To(Succeed())
+			Expect(db.PutDocument(ctx, upcomingVersion)).To(Succeed())
+
+			user = User{UUID: "00000000-0000-0000-0000-000000000001"}
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+		})
+
+		It("should get the current version of a document", func() {
+			doc, err := db.GetDocument(ctx, "document")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Content).To(Equal(currentVersion.Content))
+		})
+
+		It("should get the upcoming version of a document", func() {
+			doc, err := db.GetUpcomingDocument(ctx, "document")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Content).To(Equal(upcomingVersion.Content))
+			Expect(doc.ValidFrom).To(BeTemporally("==", upcomingVersion.ValidFrom))
+		})
+
+		It("should fail to get an upcoming version when none is scheduled", func() {
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "other-document",
+				Content:   "content",
+				ValidFrom: frozenTime,
+			})).To(Succeed())
+
+			_, err := db.GetUpcomingDocument(ctx, "other-document")
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+		})
+
+		It("should fail to put a version before the upcoming version", func() {
+			err := db.PutDocument(ctx, Document{
+				Name:      "document",
+				Content:   "newer content",
+				ValidFrom: time.Now(),
+			})
+			Expect(err).To(MatchError(ErrDocumentHistoryConflict))
+		})
+
+		It("should allow agreeing to the upcoming version in advance", func() {
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:          user.UUID,
+				DocumentName:      "document",
+				Date:              time.Now(),
+				DocumentValidFrom: &upcomingVersion.ValidFrom,
+			})).To(Succeed())
+
+			userDocuments, err := db.GetDocumentsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(userDocuments).To(HaveLen(2))
+			for _, doc := range userDocuments {
+				if doc.Upcoming {
+					Expect(doc.Content).To(Equal(upcomingVersion.Content))
+					Expect(doc.AgreementDate).ToNot(BeNil())
+				} else {
+					Expect(doc.Content).To(Equal(currentVersion.Content))
+					Expect(doc.AgreementDate).To(BeNil())
+				}
+			}
+		})
+
+		It("should fail to agree to a version that has been superseded", func() {
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "superseded-document",
+				Content:   "old content",
+				ValidFrom: frozenTime,
+			})).To(Succeed())
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "superseded-document",
+				Content:   "new content",
+				ValidFrom: frozenTime.AddDate(1, 0, 0),
+			})).To(Succeed())
+
+			err := db.PutAgreement(ctx, Agreement{
+				UserUUID:          user.UUID,
+				DocumentName:      "superseded-document",
+				Date:              time.Now(),
+				DocumentValidFrom: &frozenTime,
+			})
+			Expect(err).To(MatchError(ContainSubstring("agreements_document_superseded")))
+		})
+
+		It("should fail to agree to a version that doesn't exist", func() {
+			validFrom := frozenTime.Add(time.Second)
+			err := db.PutAgreement(ctx, Agreement{
+				UserUUID:          user.UUID,
+				DocumentName:      "document",
+				Date:              time.Now(),
+				DocumentValidFrom: &validFrom,
+			})
+			Expect(err).To(MatchError(ContainSubstring("agreements_document_not_exist")))
+		})
+	})
+
 	Describe("User", func() {
 		It("should post a user idempotently", func() {
 			user := User{
@@ -134,8 +250,8 @@ var _ = Describe("DB", func() {
 				Email: strPoint("example@example.com"),
 			}
 
-			Expect(db.PostUser(user)).To(Succeed())
-			Expect(db.PostUser(user)).To(Succeed())
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+			Expect(db.PostUser(ctx, user)).To(Succeed())
 		})
 
 		It("should fail to post a user without a uuid", func() {
@@ -144,7 +260,7 @@ var _ = Describe("DB", func() {
 				Email: strPoint("example@example.com"),
 			}
 
-			err := db.PostUser(user)
+			err := db.PostUser(ctx, user)
 			Expect(err).To(MatchError(ContainSubstring("invalid input syntax for type uuid")))
 		})
 
@@ -154,7 +270,161 @@ var _ = Describe("DB", func() {
 				Email: strPoint("newexample@example.com"),
 			}
 
-			Expect(db.PatchUser(user)).To(Succeed())
+			Expect(db.PatchUser(ctx, user)).To(Succeed())
+		})
+
+		It("should create a user only once", func() {
+			user := User{
+				UUID:     "00000000-0000-0000-0000-000000000001",
+				Email:    strPoint("example@example.com"),
+				Username: strPoint("example@example.com"),
+			}
+
+			Expect(db.CreateUser(ctx, user)).To(Succeed())
+			Expect(db.CreateUser(ctx, user)).To(MatchError(ErrUserExists))
+		})
+
+		It("should not create two users with the same username", func() {
+			Expect(db.CreateUser(ctx, User{
+				UUID:     "00000000-0000-0000-0000-000000000001",
+				Username: strPoint("example@example.com"),
+			})).To(Succeed())
+
+			err := db.CreateUser(ctx, User{
+				UUID:     "00000000-0000-0000-0000-000000000002",
+				Username: strPoint("example@example.com"),
+			})
+			Expect(err).To(MatchError(ErrUsernameTaken))
+		})
+
+		It("should not patch a user to another user's username", func() {
+			Expect(db.PostUser(ctx, User{
+				UUID:     "00000000-0000-0000-0000-000000000001",
+				Username: strPoint("example@example.com"),
+			})).To(Succeed())
+			Expect(db.PostUser(ctx, User{
+				UUID: "00000000-0000-0000-0000-000000000002",
+			})).To(Succeed())
+
+			err := db.PatchUser(ctx, User{
+				UUID:     "00000000-0000-0000-0000-000000000002",
+				Username: strPoint("example@example.com"),
+			})
+			Expect(err).To(MatchError(ErrUsernameTaken))
+		})
+
+		It("should erase a user once", func() {
+			user := User{
+				UUID:     "00000000-0000-0000-0000-000000000001",
+				Email:    strPoint("example@example.com"),
+				Username: strPoint("example@example.com"),
+			}
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+
+			erased, err := db.EraseUser(ctx, user.UUID, strPoint("admin"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(erased.Email).To(BeNil())
+			Expect(erased.Username).To(BeNil())
+			Expect(erased.ErasedAt).ToNot(BeNil())
+
+			again, err := db.EraseUser(ctx, user.UUID, strPoint("someone-else"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(again.ErasedAt).To(Equal(erased.ErasedAt))
+
+			erasure, err := db.GetErasure(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(erasure.Date).To(BeTemporally("==", *erased.ErasedAt))
+			Expect(erasure.Principal).To(Equal(strPoint("admin")))
+		})
+
+		It("should erase the personal data recorded with a user's agreements and revocations", func() {
+			Expect(db.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+			Expect(db.PostUser(ctx, User{UUID: "00000000-0000-0000-0000-000000000001"})).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000001",
+				DocumentName: "terms",
+				Date:         frozenTime.Add(time.Hour),
+				Provenance: Provenance{
+					Principal: strPoint("paas-admin"),
+					ClientIP:  strPoint("203.0.113.1"),
+					UserAgent: strPoint("Mozilla/5.0"),
+				},
+			})).To(Succeed())
+			Expect(db.PutRevocation(ctx, Revocation{
+				UserUUID:     "00000000-0000-0000-0000-000000000001",
+				DocumentName: "terms",
+				Date:         frozenTime.Add(2 * time.Hour),
+				Reason:       strPoint("I moved to 1 Example Street"),
+			})).To(Succeed())
+
+			_, err := db.EraseUser(ctx, "00000000-0000-0000-0000-000000000001", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			agreements, err := db.GetAgreementsForUserUUID(ctx, "00000000-0000-0000-0000-000000000001")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+			Expect(agreements[0].ClientIP).To(BeNil())
+			Expect(agreements[0].UserAgent).To(BeNil())
+			Expect(agreements[0].Principal).To(Equal(strPoint("paas-admin")))
+
+			revocations, err := db.GetRevocationsForUserUUID(ctx, "00000000-0000-0000-0000-000000000001")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revocations).To(HaveLen(1))
+			Expect(revocations[0].Reason).To(BeNil())
+		})
+
+		It("should only let the personal data in the agreements of an erased user be changed", func() {
+			Expect(db.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+			Expect(db.PostUser(ctx, User{UUID: "00000000-0000-0000-0000-000000000001"})).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000001",
+				DocumentName: "terms",
+				Date:         frozenTime.Add(time.Hour),
+				Provenance:   Provenance{ClientIP: strPoint("203.0.113.1")},
+			})).To(Succeed())
+
+			conn, err := sql.Open("postgres", tempDB.TempConnectionString)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Exec(`UPDATE agreements SET client_ip = NULL`)
+			Expect(err).To(MatchError(ContainSubstring("agreements_cannot_be_modified")))
+
+			_, err = db.EraseUser(ctx, "00000000-0000-0000-0000-000000000001", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = conn.Exec(`UPDATE agreements SET principal = 'someone-else'`)
+			Expect(err).To(MatchError(ContainSubstring("agreements_cannot_be_modified")))
+			_, err = conn.Exec(`UPDATE agreements SET client_ip = '198.51.100.1'`)
+			Expect(err).To(MatchError(ContainSubstring("agreements_cannot_be_modified")))
+			_, err = conn.Exec(`DELETE FROM agreements`)
+			Expect(err).To(MatchError(ContainSubstring("agreements_cannot_be_modified")))
+		})
+
+		It("should not restore the personal data of an erased user", func() {
+			user := User{
+				UUID:     "00000000-0000-0000-0000-000000000001",
+				Username: strPoint("example@example.com"),
+			}
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+			_, err := db.EraseUser(ctx, user.UUID, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = db.PatchUser(ctx, user)
+			Expect(err).To(MatchError(ErrUserErased))
+		})
+
+		It("should return no erasure for a user who has not been erased", func() {
+			Expect(db.PostUser(ctx, User{UUID: "00000000-0000-0000-0000-000000000001"})).To(Succeed())
+
+			erasure, err := db.GetErasure(ctx, "00000000-0000-0000-0000-000000000001")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(erasure).To(BeNil())
+		})
+
+		It("should return ErrUserNotFound when erasing a user that does not exist", func() {
+			_, err := db.EraseUser(ctx, "00000000-0000-0000-0000-000000000001", nil)
+			Expect(err).To(MatchError(ErrUserNotFound))
 		})
 
 		It("should return all users", func() {
@@ -162,16 +432,16 @@ var _ = Describe("DB", func() {
 				UUID:  "00000000-0000-0000-0000-000000000001",
 				Email: strPoint("example@example.com"),
 			}
-			Expect(db.PostUser(user)).To(Succeed())
+			Expect(db.PostUser(ctx, user)).To(Succeed())
 
 			user1 := User{
 				UUID:  "00000000-0000-0000-0000-000000000002",
 				Email: strPoint("newexample@example.com"),
 			}
-			Expect(db.PostUser(user1)).To(Succeed())
+			Expect(db.PostUser(ctx, user1)).To(Succeed())
 
 			userlist := []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
-			users, err := db.GetUsersByUUID(userlist)
+			users, err := db.GetUsersByUUID(ctx, userlist)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(users).To(Equal([]*User{
 				{
@@ -204,8 +474,8 @@ var _ = Describe("DB", func() {
 				Content:   "some agreement terms",
 				ValidFrom: frozenTime,
 			}
-			Expect(db.PostUser(user)).To(Succeed())
-			Expect(db.PutDocument(document)).To(Succeed())
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+			Expect(db.PutDocument(ctx, document)).To(Succeed())
 		})
 
 		It("should put Agreement", func() {
@@ -215,9 +485,9 @@ var _ = Describe("DB", func() {
 				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
 			}
 
-			Expect(db.PutAgreement(agreement)).To(Succeed())
+			Expect(db.PutAgreement(ctx, agreement)).To(Succeed())
 
-			agreements, err := db.GetAgreementsForUserUUID(user.UUID)
+			agreements, err := db.GetAgreementsForUserUUID(ctx, user.UUID)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(agreements).To(HaveLen(1))
 
@@ -226,6 +496,36 @@ var _ = Describe("DB", func() {
 			Expect(agreements[0].Date).To(BeTemporally("==", agreement.Date))
 		})
 
+		It("should put Agreement with its provenance", func() {
+			agreement := Agreement{
+				UserUUID:            user.UUID,
+				DocumentName:        document.Name,
+				Date:                time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+				DocumentValidFrom:   &document.ValidFrom,
+				DocumentContentHash: strPoint(ContentHash(document.Content)),
+				Provenance: Provenance{
+					Principal: strPoint("paas-admin"),
+					Channel:   strPoint("web"),
+					ClientIP:  strPoint("203.0.113.1"),
+					UserAgent: strPoint("Mozilla/5.0"),
+				},
+			}
+
+			Expect(db.PutAgreement(ctx, agreement)).To(Succeed())
+
+			agreements, err := db.GetAgreementsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+			Expect(*agreements[0].DocumentValidFrom).To(BeTemporally("==", document.ValidFrom))
+			Expect(agreements[0].DocumentContentHash).To(Equal(agreement.DocumentContentHash))
+			Expect(agreements[0].Provenance).To(Equal(agreement.Provenance))
+
+			userDocuments, err := db.GetDocumentsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(userDocuments).To(HaveLen(1))
+			Expect(userDocuments[0].AgreementProvenance).To(Equal(&agreement.Provenance))
+		})
+
 		It("should fail to put Agreement without a valid user UUID", func() {
 			agreement := Agreement{
 				UserUUID:     "00000000-0000-0000-0000-000000000002",
@@ -233,8 +533,9 @@ var _ = Describe("DB", func() {
 				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
 			}
 
-			err := db.PutAgreement(agreement)
+			err := db.PutAgreement(ctx, agreement)
 			Expect(err).To(MatchError(ContainSubstring("agreements_user_uuid_fkey")))
+			Expect(err).To(MatchError(ErrUserNotFound))
 		})
 
 		It("should fail to put Agreement without a valid document name", func() {
@@ -244,8 +545,9 @@ var _ = Describe("DB", func() {
 				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
 			}
 
-			err := db.PutAgreement(agreement)
+			err := db.PutAgreement(ctx, agreement)
 			Expect(err).To(MatchError(ContainSubstring("agreements_document_not_exist")))
+			Expect(err).To(MatchError(ErrAgreementDocumentNotFound))
 		})
 
 		It("should fail to put Agreement before a document is valid", func() {
@@ -255,7 +557,7 @@ var _ = Describe("DB", func() {
 				Date:         time.Date(2000, 0, 0, 0, 0, 0, 0, time.UTC),
 			}
 
-			err := db.PutAgreement(agreement)
+			err := db.PutAgreement(ctx, agreement)
 			Expect(err).To(MatchError(ContainSubstring("agreements_document_not_exist")))
 		})
 
@@ -265,10 +567,506 @@ var _ = Describe("DB", func() {
 				DocumentName: document.Name,
 			}
 
-			err := db.PutAgreement(agreement)
+			err := db.PutAgreement(ctx, agreement)
 			Expect(err).To(MatchError(ContainSubstring("agreements_date_check")))
+			Expect(err).To(MatchError(ErrInvalidInput))
+		})
+
+		It("should put Agreement for a new user", func() {
+			agreement := Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000002",
+				DocumentName: document.Name,
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			}
+
+			Expect(db.PutAgreementForUser(ctx, agreement)).To(Succeed())
+
+			_, err := db.GetUser(ctx, agreement.UserUUID)
+			Expect(err).ToNot(HaveOccurred())
+
+			agreements, err := db.GetAgreementsForUserUUID(ctx, agreement.UserUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+		})
+
+		It("should put Agreement for an existing user", func() {
+			agreement := Agreement{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			}
+
+			Expect(db.PutAgreementForUser(ctx, agreement)).To(Succeed())
+
+			existingUser, err := db.GetUser(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(existingUser.Email).To(Equal(user.Email))
+		})
+
+		It("should not create a user when their agreement is rejected", func() {
+			agreement := Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000002",
+				DocumentName: "non-existant-doc",
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			}
+
+			err := db.PutAgreementForUser(ctx, agreement)
+			Expect(err).To(MatchError(ErrAgreementDocumentNotFound))
+
+			_, err = db.GetUser(ctx, agreement.UserUUID)
+			Expect(err).To(MatchError(ErrUserNotFound))
+		})
+
+	})
+
+	Describe("GetDocuments", func() {
+		BeforeEach(func() {
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "document-one",
+				Content:   "first content",
+				ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+			})).To(Succeed())
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "document-one",
+				Content:   "second content",
+				ValidFrom: time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			})).To(Succeed())
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "document-two",
+				Content:   "other content",
+				ValidFrom: time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			})).To(Succeed())
+		})
+
+		It("should summarise the latest version of every document", func() {
+			documents, err := db.GetDocuments(ctx, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(documents).To(HaveLen(2))
+
+			Expect(documents[0].Name).To(Equal("document-one"))
+			Expect(documents[0].ValidFrom).To(BeTemporally("==", time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC)))
+			Expect(documents[0].VersionCount).To(Equal(2))
+			Expect(documents[0].ContentHash).To(Equal(ContentHash("second content")))
+
+			Expect(documents[1].Name).To(Equal("document-two"))
+			Expect(documents[1].VersionCount).To(Equal(1))
 		})
 
+		It("should only return documents updated since a given time", func() {
+			updatedSince := time.Date(2002, 6, 1, 0, 0, 0, 0, time.UTC)
+			documents, err := db.GetDocuments(ctx, &updatedSince)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(documents).To(HaveLen(1))
+			Expect(documents[0].Name).To(Equal("document-one"))
+		})
+	})
+
+	Describe("DocumentVersions", func() {
+		var (
+			firstVersion, secondVersion Document
+		)
+
+		BeforeEach(func() {
+			firstVersion = Document{
+				Name:      "document",
+				Content:   "first content",
+				ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+			}
+			secondVersion = Document{
+				Name:      "document",
+				Content:   "second content",
+				ValidFrom: time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			}
+			Expect(db.PutDocument(ctx, firstVersion)).To(Succeed())
+			Expect(db.PutDocument(ctx, secondVersion)).To(Succeed())
+
+			for _, uuid := range []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"} {
+				Expect(db.PostUser(ctx, User{UUID: uuid})).To(Succeed())
+				Expect(db.PutAgreement(ctx, Agreement{
+					UserUUID:     uuid,
+					DocumentName: "document",
+					Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+				})).To(Succeed())
+			}
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000001",
+				DocumentName: "document",
+				Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
+			})).To(Succeed())
+		})
+
+		It("should list every version with agreement counts", func() {
+			versions, err := db.GetDocumentVersions(ctx, "document")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions).To(HaveLen(2))
+
+			Expect(versions[0].Version).To(Equal(1))
+			Expect(versions[0].Content).To(Equal(firstVersion.Content))
+			Expect(versions[0].ValidFrom).To(BeTemporally("==", firstVersion.ValidFrom))
+			Expect(versions[0].AgreementCount).To(Equal(2))
+
+			Expect(versions[1].Version).To(Equal(2))
+			Expect(versions[1].Content).To(Equal(secondVersion.Content))
+			Expect(versions[1].ValidFrom).To(BeTemporally("==", secondVersion.ValidFrom))
+			Expect(versions[1].AgreementCount).To(Equal(1))
+		})
+
+		It("should fail to list versions of a document that doesn't exist", func() {
+			_, err := db.GetDocumentVersions(ctx, "non-existent")
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+		})
+
+		It("should get a version by number", func() {
+			version, err := db.GetDocumentVersion(ctx, "document", 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.Content).To(Equal(secondVersion.Content))
+
+			_, err = db.GetDocumentVersion(ctx, "document", 3)
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+		})
+
+		It("should get the version that was the latest at a given time", func() {
+			version, err := db.GetDocumentVersionAt(ctx, "document", time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.Version).To(Equal(1))
+
+			version, err = db.GetDocumentVersionAt(ctx, "document", secondVersion.ValidFrom)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.Version).To(Equal(2))
+
+			_, err = db.GetDocumentVersionAt(ctx, "document", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+		})
+	})
+
+	Describe("GetUsersWithOutstandingDocument", func() {
+		var (
+			agreedUser, supersededUser, unagreedUser User
+			currentVersion                           Document
+		)
+
+		BeforeEach(func() {
+			agreedUser = User{UUID: "00000000-0000-0000-0000-000000000001", Username: strPoint("agreed")}
+			supersededUser = User{UUID: "00000000-0000-0000-0000-000000000002", Username: strPoint("superseded")}
+			unagreedUser = User{UUID: "00000000-0000-0000-0000-000000000003", Username: strPoint("unagreed")}
+			for _, user := range []User{agreedUser, supersededUser, unagreedUser} {
+				Expect(db.PostUser(ctx, user)).To(Succeed())
+			}
+
+			Expect(db.PutDocument(ctx, Document{
+				Name:      "document",
+				Content:   "first content",
+				ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+			})).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     supersededUser.UUID,
+				DocumentName: "document",
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			})).To(Succeed())
+
+			currentVersion = Document{
+				Name:      "document",
+				Content:   "second content",
+				ValidFrom: time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			}
+			Expect(db.PutDocument(ctx, currentVersion)).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     agreedUser.UUID,
+				DocumentName: "document",
+				Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
+			})).To(Succeed())
+		})
+
+		It("should return users who have not agreed to the current version", func() {
+			users, err := db.GetUsersWithOutstandingDocument(ctx, "document", 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(HaveLen(2))
+			Expect(users[0].UUID).To(Equal(supersededUser.UUID))
+			Expect(users[1].UUID).To(Equal(unagreedUser.UUID))
+		})
+
+		It("should leave out erased users", func() {
+			_, err := db.EraseUser(ctx, unagreedUser.UUID, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			users, err := db.GetUsersWithOutstandingDocument(ctx, "document", 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(HaveLen(1))
+			Expect(users[0].UUID).To(Equal(supersededUser.UUID))
+		})
+
+		It("should paginate", func() {
+			users, err := db.GetUsersWithOutstandingDocument(ctx, "document", 1, 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(HaveLen(1))
+			Expect(users[0].UUID).To(Equal(unagreedUser.UUID))
+		})
+
+		It("should fail for a document that doesn't exist", func() {
+			_, err := db.GetUsersWithOutstandingDocument(ctx, "non-existent", 0, 0)
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+		})
+	})
+
+	Describe("GetStats", func() {
+		It("should count users, agreements and outstanding agreements", func() {
+			for _, uuid := range []string{
+				"00000000-0000-0000-0000-000000000001",
+				"00000000-0000-0000-0000-000000000002",
+				"00000000-0000-0000-0000-000000000003",
+			} {
+				Expect(db.PostUser(ctx, User{UUID: uuid})).To(Succeed())
+			}
+			_, err := db.EraseUser(ctx, "00000000-0000-0000-0000-000000000003", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, name := range []string{"document-one", "document-two"} {
+				Expect(db.PutDocument(ctx, Document{
+					Name:      name,
+					Content:   "content",
+					ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+				})).To(Succeed())
+			}
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000001",
+				DocumentName: "document-one",
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			})).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     "00000000-0000-0000-0000-000000000002",
+				DocumentName: "document-one",
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			})).To(Succeed())
+
+			stats, err := db.GetStats(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(Equal(Stats{
+				Users:      2,
+				Agreements: 2,
+				OutstandingByDocument: map[string]int{
+					"document-one": 0,
+					"document-two": 2,
+				},
+			}))
+		})
+	})
+
+	Describe("Collectors", func() {
+		usersGauge := func(registry *prometheus.Registry) float64 {
+			families, err := registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() == "paas_accounts_users" {
+					return family.GetMetric()[0].GetGauge().GetValue()
+				}
+			}
+			Fail("paas_accounts_users was not collected")
+			return 0
+		}
+
+		It("should reuse the counts until the stats interval has passed", func() {
+			cached, err := Open(Config{URL: tempDB.TempConnectionString, StatsInterval: time.Hour})
+			Expect(err).ToNot(HaveOccurred())
+			defer cached.Close()
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(cached.Collectors()...)
+
+			Expect(db.PostUser(ctx, User{UUID: "00000000-0000-0000-0000-000000000001"})).To(Succeed())
+			Expect(usersGauge(registry)).To(Equal(1.0))
+
+			Expect(db.PostUser(ctx, User{UUID: "00000000-0000-0000-0000-000000000002"})).To(Succeed())
+			Expect(usersGauge(registry)).To(Equal(1.0))
+
+			uncached := prometheus.NewRegistry()
+			uncached.MustRegister(db.Collectors()...)
+			Expect(usersGauge(uncached)).To(Equal(2.0))
+		})
+	})
+
+	Describe("FilterAgreementsForUserUUID", func() {
+		var (
+			user                       User
+			documentOne, documentTwo   Document
+			agreementOne, agreementTwo Agreement
+			agreementThree             Agreement
+		)
+
+		BeforeEach(func() {
+			user = User{
+				UUID:  "00000000-0000-0000-0000-000000000001",
+				Email: strPoint("example@example.com"),
+			}
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+
+			documentOne = Document{
+				Name:      "document-one",
+				Content:   "content one",
+				ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+			}
+			Expect(db.PutDocument(ctx, documentOne)).To(Succeed())
+
+			documentTwo = Document{
+				Name:      "document-two",
+				Content:   "content two",
+				ValidFrom: time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC),
+			}
+			Expect(db.PutDocument(ctx, documentTwo)).To(Succeed())
+
+			agreementOne = Agreement{
+				UserUUID:     user.UUID,
+				DocumentName: documentOne.Name,
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			}
+			agreementTwo = Agreement{
+				UserUUID:     user.UUID,
+				DocumentName: documentTwo.Name,
+				Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			}
+			agreementThree = Agreement{
+				UserUUID:     user.UUID,
+				DocumentName: documentOne.Name,
+				Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
+			}
+			Expect(db.PutAgreement(ctx, agreementOne)).To(Succeed())
+			Expect(db.PutAgreement(ctx, agreementTwo)).To(Succeed())
+			Expect(db.PutAgreement(ctx, agreementThree)).To(Succeed())
+		})
+
+		It("should return every agreement without a filter", func() {
+			agreements, err := db.FilterAgreementsForUserUUID(ctx, user.UUID, AgreementFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(3))
+			Expect(agreements[0].Date).To(BeTemporally("==", agreementOne.Date))
+			Expect(agreements[1].Date).To(BeTemporally("==", agreementTwo.Date))
+			Expect(agreements[2].Date).To(BeTemporally("==", agreementThree.Date))
+		})
+
+		It("should filter by document name", func() {
+			agreements, err := db.FilterAgreementsForUserUUID(ctx, user.UUID, AgreementFilter{
+				DocumentName: documentTwo.Name,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+			Expect(agreements[0].DocumentName).To(Equal(documentTwo.Name))
+		})
+
+		It("should filter by a half-open date range", func() {
+			agreements, err := db.FilterAgreementsForUserUUID(ctx, user.UUID, AgreementFilter{
+				From: &agreementTwo.Date,
+				To:   &agreementThree.Date,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+			Expect(agreements[0].Date).To(BeTemporally("==", agreementTwo.Date))
+		})
+
+		It("should paginate", func() {
+			agreements, err := db.FilterAgreementsForUserUUID(ctx, user.UUID, AgreementFilter{
+				Limit:  1,
+				Offset: 1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+			Expect(agreements[0].Date).To(BeTemporally("==", agreementTwo.Date))
+		})
+	})
+
+	Describe("Revocation", func() {
+		var (
+			user     User
+			document Document
+		)
+
+		BeforeEach(func() {
+			user = User{UUID: "00000000-0000-0000-0000-000000000001"}
+			document = Document{
+				Name:      "document",
+				Content:   "some agreement terms",
+				ValidFrom: frozenTime,
+			}
+			Expect(db.PostUser(ctx, user)).To(Succeed())
+			Expect(db.PutDocument(ctx, document)).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2002, 2, 2, 2, 2, 2, 0, time.UTC),
+			})).To(Succeed())
+		})
+
+		It("should put and get a revocation", func() {
+			revocation := Revocation{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+				Reason:       strPoint("changed my mind"),
+			}
+			Expect(db.PutRevocation(ctx, revocation)).To(Succeed())
+
+			revocations, err := db.GetRevocationsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revocations).To(HaveLen(1))
+			Expect(revocations[0].DocumentName).To(Equal(document.Name))
+			Expect(revocations[0].Date).To(BeTemporally("==", revocation.Date))
+			Expect(revocations[0].Reason).To(Equal(revocation.Reason))
+		})
+
+		It("should leave the agreement history untouched", func() {
+			Expect(db.PutRevocation(ctx, Revocation{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			})).To(Succeed())
+
+			agreements, err := db.GetAgreementsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+		})
+
+		It("should treat a revoked agreement as outstanding", func() {
+			Expect(db.PutRevocation(ctx, Revocation{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			})).To(Succeed())
+
+			userDocuments, err := db.GetDocumentsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(userDocuments).To(HaveLen(1))
+			Expect(userDocuments[0].AgreementDate).To(BeNil())
+
+			users, err := db.GetUsersWithOutstandingDocument(ctx, document.Name, 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(HaveLen(1))
+		})
+
+		It("should honour an agreement made after a revocation", func() {
+			Expect(db.PutRevocation(ctx, Revocation{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			})).To(Succeed())
+			Expect(db.PutAgreement(ctx, Agreement{
+				UserUUID:     user.UUID,
+				DocumentName: document.Name,
+				Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
+			})).To(Succeed())
+
+			userDocuments, err := db.GetDocumentsForUserUUID(ctx, user.UUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(userDocuments).To(HaveLen(1))
+			Expect(userDocuments[0].AgreementDate).ToNot(BeNil())
+			Expect(*userDocuments[0].AgreementDate).To(BeTemporally("==", time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC)))
+		})
+
+		It("should fail to revoke an agreement that was never made", func() {
+			err := db.PutRevocation(ctx, Revocation{
+				UserUUID:     user.UUID,
+				DocumentName: "other-document",
+				Date:         time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
+			})
+			Expect(err).To(MatchError(ErrAgreementNotFound))
+		})
 	})
 
 	Describe("GetDocumentsForUserUUID", func() {
@@ -283,7 +1081,7 @@ var _ = Describe("DB", func() {
 				UUID:  "00000000-0000-0000-0000-000000000001",
 				Email: strPoint("example@example.com"),
 			}
-			Expect(db.PostUser(user)).To(Succeed())
+			Expect(db.PostUser(ctx, user)).To(Succeed())
 
 			documentAgreed = Document{
 				Name:      "document-agreed",
@@ -294,33 +1092,33 @@ var _ = Describe("DB", func() {
 			documentSuperseded = documentAgreed
 			documentSuperseded.ValidFrom = documentAgreed.ValidFrom.AddDate(-1, 0, 0)
 			documentSuperseded.Content = documentAgreed.Content + " v2"
-			Expect(db.PutDocument(documentSuperseded)).To(Succeed())
+			Expect(db.PutDocument(ctx, documentSuperseded)).To(Succeed())
 
 			agreementSuperseded = Agreement{
 				UserUUID:     user.UUID,
 				DocumentName: documentSuperseded.Name,
 				Date:         documentSuperseded.ValidFrom,
 			}
-			Expect(db.PutAgreement(agreementSuperseded)).To(Succeed())
-			Expect(db.PutDocument(documentAgreed)).To(Succeed())
+			Expect(db.PutAgreement(ctx, agreementSuperseded)).To(Succeed())
+			Expect(db.PutDocument(ctx, documentAgreed)).To(Succeed())
 
 			agreement = Agreement{
 				UserUUID:     user.UUID,
 				DocumentName: documentAgreed.Name,
 				Date:         time.Date(2004, 4, 4, 4, 4, 4, 0, time.UTC),
 			}
-			Expect(db.PutAgreement(agreement)).To(Succeed())
+			Expect(db.PutAgreement(ctx, agreement)).To(Succeed())
 
 			documentUnagreed = Document{
 				Name:      "document-unagreed",
 				Content:   "content unagreed",
 				ValidFrom: time.Date(2003, 3, 3, 3, 3, 3, 0, time.UTC),
 			}
-			Expect(db.PutDocument(documentUnagreed)).To(Succeed())
+			Expect(db.PutDocument(ctx, documentUnagreed)).To(Succeed())
 		})
 
 		It("should return all relevant documents for a user", func() {
-			userDocuments, err := db.GetDocumentsForUserUUID(user.UUID)
+			userDocuments, err := db.GetDocumentsForUserUUID(ctx, user.UUID)
 			preset := []UserDocument{
 				{
 					Name:          documentSuperseded.Name,
@@ -352,3 +1150,38 @@ var _ = Describe("DB", func() {
 		})
 	})
 })
+
+var _ = Describe("DB without a connection", func() {
+	It("should report a cancelled context as ErrCanceled", func() {
+		db, err := Open(Config{URL: "postgres://nobody@127.0.0.1:1/nothing?sslmode=disable"})
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = db.GetUser(cancelled, "00000000-0000-0000-0000-000000000001")
+		Expect(err).To(MatchError(ErrCanceled))
+	})
+
+	It("should report a cancelled context as ErrCanceled when looking up users by email", func() {
+		db, err := Open(Config{URL: "postgres://nobody@127.0.0.1:1/nothing?sslmode=disable"})
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = db.GetUserByEmail(cancelled, "example@example.com")
+		Expect(err).To(MatchError(ErrCanceled))
+	})
+
+	It("should report a query that runs out of time as ErrTimeout", func() {
+		db, err := Open(Config{URL: "postgres://nobody@127.0.0.1:1/nothing?sslmode=disable", QueryTimeout: time.Nanosecond})
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		_, err = db.GetUser(ctx, "00000000-0000-0000-0000-000000000001")
+		Expect(err).To(MatchError(ErrTimeout))
+	})
+})
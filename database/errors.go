@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidInput                  = errors.New("invalid input")
+	ErrImmutable                     = errors.New("history cannot be modified")
+	ErrAgreementDocumentNotFound     = errors.New("no version of the document exists for the agreement")
+	ErrAgreementDocumentSuperseded   = errors.New("the document version agreed to has been superseded")
+	ErrAgreementDocumentHashMismatch = errors.New("the document content hash does not match the version agreed to")
+	ErrUserExists                    = errors.New("user already exists")
+	ErrUsernameTaken                 = errors.New("username already in use")
+	ErrUserErased                    = errors.New("user has been erased")
+	ErrCanceled                      = errors.New("the query was cancelled")
+	ErrTimeout                       = errors.New("the query timed out")
+)
+
+// exceptionErrors maps the exceptions raised by the triggers in sql/ to the
+// errors they represent.
+var exceptionErrors = map[string]error{
+	"cannot_alter_document_history":             ErrDocumentHistoryConflict,
+	"documents_cannot_be_modified":              ErrImmutable,
+	"agreements_document_not_exist":             ErrAgreementDocumentNotFound,
+	"agreements_document_superseded":            ErrAgreementDocumentSuperseded,
+	"agreements_document_hash_mismatch":         ErrAgreementDocumentHashMismatch,
+	"agreements_cannot_be_modified":             ErrImmutable,
+	"agreement_revocations_agreement_not_exist": ErrAgreementNotFound,
+	"agreement_revocations_cannot_be_modified":  ErrImmutable,
+	"users_erased":                              ErrUserErased,
+	"user_erasures_cannot_be_modified":          ErrImmutable,
+}
+
+// foreignKeyErrors maps foreign key constraints to the error returned when
+// the row they reference does not exist.
+var foreignKeyErrors = map[string]error{
+	"agreements_user_uuid_fkey":            ErrUserNotFound,
+	"agreement_revocations_user_uuid_fkey": ErrUserNotFound,
+	"user_erasures_user_uuid_fkey":         ErrUserNotFound,
+}
+
+// uniqueErrors maps unique constraints to the error returned when a write
+// would duplicate an existing value.
+var uniqueErrors = map[string]error{
+	"users_pkey":         ErrUserExists,
+	"users_username_key": ErrUsernameTaken,
+}
+
+// Error is returned when Postgres rejects a statement for a reason we know
+// how to describe. It unwraps to one of the errors declared by this package,
+// so it can be checked with errors.Is, and keeps the original message.
+type Error struct {
+	Err   error
+	Cause *pq.Error
+}
+
+func (e *Error) Error() string {
+	return e.Cause.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// translateError maps Postgres errors to typed errors using their SQLSTATE
+// code, passing any other error through unchanged.
+func translateError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	var typed error
+	switch pqErr.Code.Name() {
+	case "raise_exception":
+		typed = exceptionErrors[pqErr.Message]
+	case "foreign_key_violation":
+		typed = foreignKeyErrors[pqErr.Constraint]
+	case "unique_violation":
+		typed = uniqueErrors[pqErr.Constraint]
+	case "check_violation", "not_null_violation", "invalid_text_representation", "invalid_datetime_format":
+		typed = ErrInvalidInput
+	}
+
+	if typed == nil {
+		return err
+	}
+
+	return &Error{Err: typed, Cause: pqErr}
+}
+
+// contextError reports a query that was stopped because its context was
+// cancelled as ErrCanceled, or because it ran out of time as ErrTimeout,
+// passing any other error through unchanged.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrCanceled) || errors.Is(err, ErrTimeout) {
+		return err
+	}
+
+	pqErr, ok := err.(*pq.Error)
+	stopped := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		(ok && pqErr.Code.Name() == "query_canceled")
+	if !stopped {
+		return err
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+		(ok && strings.Contains(pqErr.Message, "statement timeout")) {
+		return fmt.Errorf("%w: %s", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %s", ErrCanceled, err)
+}
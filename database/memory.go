@@ -0,0 +1,915 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// epoch is the earliest date the tables accept, exclusive.
+var epoch = time.Unix(0, 0)
+
+// MemoryStore is a Store that keeps everything in memory, for tests that do
+// not need Postgres. It enforces the same rules as the constraints and
+// triggers in sql/: document history is linear, agreements, revocations and
+// erasures cannot be changed, an agreement needs a version of the document to
+// agree to, and an erased user cannot be given back their personal data.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	documents   map[string][]Document // the versions of each document, oldest first
+	users       map[string]User
+	erasures    map[string]Erasure
+	agreements  []Agreement
+	revocations []Revocation
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		documents: map[string][]Document{},
+		users:     map[string]User{},
+		erasures:  map[string]Erasure{},
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// PutDocument stores a new version of a document, unless its content matches
+// the latest version, including any version scheduled for the future.
+func (s *MemoryStore) PutDocument(ctx context.Context, doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	doc.ValidFrom = timestamp(doc.ValidFrom)
+	versions := s.documents[doc.Name]
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		if latest.Content == doc.Content {
+			return nil
+		}
+		if !latest.ValidFrom.Before(doc.ValidFrom) {
+			return ErrDocumentHistoryConflict
+		}
+	}
+	if doc.Name == "" || doc.Content == "" || !doc.ValidFrom.After(epoch) {
+		return ErrInvalidInput
+	}
+
+	s.documents[doc.Name] = append(versions, doc)
+	return nil
+}
+
+// GetDocument returns the version of a document that is currently in force,
+// ignoring any version scheduled for the future.
+func (s *MemoryStore) GetDocument(ctx context.Context, name string) (Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return Document{}, err
+	}
+
+	i, ok := s.currentVersion(name)
+	if !ok {
+		return Document{}, ErrDocumentNotFound
+	}
+	return s.documents[name][i], nil
+}
+
+// GetUpcomingDocument returns the next version of a document that is
+// scheduled to come into force.
+func (s *MemoryStore) GetUpcomingDocument(ctx context.Context, name string) (Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return Document{}, err
+	}
+
+	now := time.Now()
+	for _, version := range s.documents[name] {
+		if version.ValidFrom.After(now) {
+			return version, nil
+		}
+	}
+	return Document{}, ErrDocumentNotFound
+}
+
+// GetDocuments summarises the latest version of every document, including
+// versions scheduled for the future. When updatedSince is set only documents
+// with a version newer than it are returned.
+func (s *MemoryStore) GetDocuments(ctx context.Context, updatedSince *time.Time) ([]DocumentSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	documents := []DocumentSummary{}
+	for _, name := range s.documentNames() {
+		versions := s.documents[name]
+		latest := versions[len(versions)-1]
+		if updatedSince != nil && !latest.ValidFrom.After(*updatedSince) {
+			continue
+		}
+		documents = append(documents, DocumentSummary{
+			Name:         latest.Name,
+			ValidFrom:    latest.ValidFrom,
+			VersionCount: len(versions),
+			ContentHash:  ContentHash(latest.Content),
+		})
+	}
+	return documents, nil
+}
+
+// GetDocumentVersions returns every version of a document, oldest first,
+// along with the number of users who agreed to each version.
+func (s *MemoryStore) GetDocumentVersions(ctx context.Context, name string) ([]DocumentVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	if len(s.documents[name]) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+
+	versions := []DocumentVersion{}
+	for i := range s.documents[name] {
+		versions = append(versions, s.documentVersion(name, i))
+	}
+	return versions, nil
+}
+
+// GetDocumentVersion returns a document by its ordinal version number,
+// starting from 1 for the first version.
+func (s *MemoryStore) GetDocumentVersion(ctx context.Context, name string, version int) (DocumentVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return DocumentVersion{}, err
+	}
+
+	if version < 1 || version > len(s.documents[name]) {
+		return DocumentVersion{}, ErrDocumentNotFound
+	}
+	return s.documentVersion(name, version-1), nil
+}
+
+// GetDocumentVersionAt returns the version of a document that was the latest
+// version at the given time.
+func (s *MemoryStore) GetDocumentVersionAt(ctx context.Context, name string, at time.Time) (DocumentVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return DocumentVersion{}, err
+	}
+
+	i, ok := s.versionAt(name, timestamp(at))
+	if !ok {
+		return DocumentVersion{}, ErrDocumentNotFound
+	}
+	return s.documentVersion(name, i), nil
+}
+
+// GetUsersWithOutstandingDocument returns every user, ordered by UUID, who
+// has not agreed to the version of a document currently in force. Erased
+// users are left out. A zero limit returns every user.
+func (s *MemoryStore) GetUsersWithOutstandingDocument(ctx context.Context, name string, limit int, offset int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.currentVersion(name); !ok {
+		return nil, ErrDocumentNotFound
+	}
+
+	users := []User{}
+	for _, user := range s.sortedUsers() {
+		if s.outstanding(user, name) {
+			users = append(users, copyUser(user))
+		}
+	}
+	return page(users, limit, offset), nil
+}
+
+// PostUser creates a user if no user with the same UUID exists, and
+// otherwise does nothing.
+func (s *MemoryStore) PostUser(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	id, err := parseUUID(user.UUID)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.users[id]; ok {
+		return nil
+	}
+	return s.insertUser(id, user)
+}
+
+// CreateUser creates a new user. It returns ErrUserExists if a user with the
+// same UUID exists, or ErrUsernameTaken if another user has the username.
+func (s *MemoryStore) CreateUser(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	id, err := parseUUID(user.UUID)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.users[id]; ok {
+		return ErrUserExists
+	}
+	return s.insertUser(id, user)
+}
+
+func (s *MemoryStore) insertUser(id string, user User) error {
+	if s.usernameTaken(user.Username, id) {
+		return ErrUsernameTaken
+	}
+
+	s.users[id] = User{
+		UUID:     id,
+		Email:    lowerStrPoint(user.Email),
+		Username: copyStr(user.Username),
+	}
+	return nil
+}
+
+func (s *MemoryStore) PatchUser(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	id, err := parseUUID(user.UUID)
+	if err != nil {
+		return err
+	}
+	existing, ok := s.users[id]
+	if !ok {
+		return nil
+	}
+	if existing.ErasedAt != nil && (user.Email != nil || user.Username != nil) {
+		return ErrUserErased
+	}
+	if s.usernameTaken(user.Username, id) {
+		return ErrUsernameTaken
+	}
+
+	existing.Email = lowerStrPoint(user.Email)
+	existing.Username = copyStr(user.Username)
+	s.users[id] = existing
+	return nil
+}
+
+// EraseUser removes the email address and username of a user, the IP
+// address and user agent recorded with their agreements and the reasons given
+// for their revocations, and records the erasure. Erasing a user who has
+// already been erased does nothing.
+func (s *MemoryStore) EraseUser(ctx context.Context, userUUID string, principal *string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return User{}, err
+	}
+
+	id, err := parseUUID(userUUID)
+	if err != nil {
+		return User{}, err
+	}
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+
+	if user.ErasedAt == nil {
+		erasedAt := timestamp(time.Now())
+		user.Email = nil
+		user.Username = nil
+		user.ErasedAt = &erasedAt
+		s.users[id] = user
+		s.erasures[id] = Erasure{UserUUID: id, Date: erasedAt, Principal: copyStr(principal)}
+		for i := range s.agreements {
+			if s.agreements[i].UserUUID == id {
+				s.agreements[i].ClientIP = nil
+				s.agreements[i].UserAgent = nil
+			}
+		}
+		for i := range s.revocations {
+			if s.revocations[i].UserUUID == id {
+				s.revocations[i].Reason = nil
+			}
+		}
+	}
+
+	return copyUser(user), nil
+}
+
+// GetErasure returns the erasure of a user, or nil if they have not been
+// erased.
+func (s *MemoryStore) GetErasure(ctx context.Context, userUUID string) (*Erasure, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUUID(userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	erasure, ok := s.erasures[id]
+	if !ok {
+		return nil, nil
+	}
+	erasure.Principal = copyStr(erasure.Principal)
+	return &erasure, nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, userUUID string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return User{}, err
+	}
+
+	id, err := parseUUID(userUUID)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) ([]*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	var users []*User
+	for _, user := range s.sortedUsers() {
+		if user.Email != nil && *user.Email == email {
+			user = copyUser(user)
+			users = append(users, &user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return User{}, err
+	}
+
+	for _, user := range s.users {
+		if user.Username != nil && *user.Username == username {
+			return copyUser(user), nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *MemoryStore) GetUsersByUUID(ctx context.Context, uuids []string) ([]*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	users := []*User{}
+	for _, userUUID := range uuids {
+		id, err := parseUUID(userUUID)
+		if err != nil {
+			return nil, err
+		}
+		user, ok := s.users[id]
+		if !ok {
+			users = append(users, nil)
+			continue
+		}
+		user = copyUser(user)
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) PutAgreement(ctx context.Context, agreement Agreement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	agreement, err := s.checkAgreement(agreement, false)
+	if err != nil {
+		return err
+	}
+
+	s.agreements = append(s.agreements, agreement)
+	return nil
+}
+
+// PutAgreementForUser records an agreement, creating the user if they do not
+// already exist. A rejected agreement does not leave a new user behind.
+func (s *MemoryStore) PutAgreementForUser(ctx context.Context, agreement Agreement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	agreement, err := s.checkAgreement(agreement, true)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.users[agreement.UserUUID]; !ok {
+		s.users[agreement.UserUUID] = User{UUID: agreement.UserUUID}
+	}
+	s.agreements = append(s.agreements, agreement)
+	return nil
+}
+
+// checkAgreement returns a copy of an agreement as it would be stored, or
+// the error the agreements table would reject it with. When creatingUser is
+// true the user is about to be created, so need not exist yet.
+func (s *MemoryStore) checkAgreement(agreement Agreement, creatingUser bool) (Agreement, error) {
+	id, err := parseUUID(agreement.UserUUID)
+	if err != nil {
+		return Agreement{}, err
+	}
+	agreement = copyAgreement(agreement)
+	agreement.UserUUID = id
+	agreement.Date = timestamp(agreement.Date)
+	if agreement.DocumentValidFrom != nil {
+		*agreement.DocumentValidFrom = timestamp(*agreement.DocumentValidFrom)
+	}
+
+	if !agreement.Date.After(epoch) {
+		return Agreement{}, ErrInvalidInput
+	}
+	for _, existing := range s.agreements {
+		if existing.UserUUID == id && existing.DocumentName == agreement.DocumentName && existing.Date.Equal(agreement.Date) {
+			return Agreement{}, duplicateKeyError("agreements_pkey")
+		}
+	}
+	if _, ok := s.users[id]; !ok && !creatingUser {
+		return Agreement{}, ErrUserNotFound
+	}
+
+	versions := s.documents[agreement.DocumentName]
+	var version *Document
+	if agreement.DocumentValidFrom == nil {
+		if i, ok := s.versionAt(agreement.DocumentName, agreement.Date); ok {
+			version = &versions[i]
+		}
+	} else {
+		for i := range versions {
+			if versions[i].ValidFrom.Equal(*agreement.DocumentValidFrom) {
+				version = &versions[i]
+			}
+		}
+	}
+	if version == nil {
+		return Agreement{}, ErrAgreementDocumentNotFound
+	}
+
+	hash := ContentHash(version.Content)
+	if agreement.DocumentContentHash == nil {
+		agreement.DocumentContentHash = &hash
+	} else if *agreement.DocumentContentHash != hash {
+		return Agreement{}, ErrAgreementDocumentHashMismatch
+	}
+
+	if agreement.DocumentValidFrom != nil {
+		for _, later := range versions {
+			if later.ValidFrom.After(*agreement.DocumentValidFrom) && !later.ValidFrom.After(agreement.Date) {
+				return Agreement{}, ErrAgreementDocumentSuperseded
+			}
+		}
+	}
+
+	return agreement, nil
+}
+
+func (s *MemoryStore) GetDocumentsForUserUUID(ctx context.Context, userUUID string) ([]UserDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUUID(userUUID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	userDocuments := []UserDocument{}
+	for _, name := range s.documentNames() {
+		for i, version := range s.documents[name] {
+			userDocument := UserDocument{
+				Name:      version.Name,
+				Content:   version.Content,
+				ValidFrom: version.ValidFrom,
+				Upcoming:  version.ValidFrom.After(now),
+			}
+			agreed := false
+			for _, agreement := range s.agreements {
+				if agreement.UserUUID != id || !s.appliesTo(agreement, name, i) {
+					continue
+				}
+				agreed = true
+				date := agreement.Date
+				userDocument.AgreementDate = &date
+				userDocument.AgreementProvenance = nil
+				if agreement.Provenance.recorded() {
+					provenance := copyAgreement(agreement).Provenance
+					userDocument.AgreementProvenance = &provenance
+				}
+				userDocuments = append(userDocuments, userDocument)
+			}
+			if !agreed {
+				userDocuments = append(userDocuments, userDocument)
+			}
+		}
+	}
+
+	// Ordered by agreement date, with the documents not agreed to last
+	sort.SliceStable(userDocuments, func(i, j int) bool {
+		a, b := userDocuments[i].AgreementDate, userDocuments[j].AgreementDate
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.Before(*b)
+	})
+	return userDocuments, nil
+}
+
+func (s *MemoryStore) GetAgreementsForUserUUID(ctx context.Context, userUUID string) ([]Agreement, error) {
+	return s.FilterAgreementsForUserUUID(ctx, userUUID, AgreementFilter{})
+}
+
+// FilterAgreementsForUserUUID returns the raw agreement history for a user,
+// restricted to a document name and to the half-open date range [From, To)
+// when those are set. A zero Limit returns every matching agreement.
+func (s *MemoryStore) FilterAgreementsForUserUUID(ctx context.Context, userUUID string, filter AgreementFilter) ([]Agreement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUUID(userUUID)
+	if err != nil {
+		return nil, err
+	}
+	agreements := []Agreement{}
+	for _, agreement := range s.agreements {
+		if agreement.UserUUID != id {
+			continue
+		}
+		if filter.DocumentName != "" && agreement.DocumentName != filter.DocumentName {
+			continue
+		}
+		if filter.From != nil && agreement.Date.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !agreement.Date.Before(*filter.To) {
+			continue
+		}
+		agreements = append(agreements, copyAgreement(agreement))
+	}
+
+	sort.SliceStable(agreements, func(i, j int) bool {
+		if !agreements[i].Date.Equal(agreements[j].Date) {
+			return agreements[i].Date.Before(agreements[j].Date)
+		}
+		return agreements[i].DocumentName < agreements[j].DocumentName
+	})
+	return page(agreements, filter.Limit, filter.Offset), nil
+}
+
+// PutRevocation records that a user has withdrawn their agreement to a
+// document. Every agreement to the document made before the revocation is
+// treated as revoked, but the agreements themselves are left untouched.
+func (s *MemoryStore) PutRevocation(ctx context.Context, revocation Revocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return err
+	}
+
+	id, err := parseUUID(revocation.UserUUID)
+	if err != nil {
+		return err
+	}
+	revocation.UserUUID = id
+	revocation.Date = timestamp(revocation.Date)
+	revocation.Reason = copyStr(revocation.Reason)
+
+	if !revocation.Date.After(epoch) {
+		return ErrInvalidInput
+	}
+	for _, existing := range s.revocations {
+		if existing.UserUUID == id && existing.DocumentName == revocation.DocumentName && existing.Date.Equal(revocation.Date) {
+			return duplicateKeyError("agreement_revocations_pkey")
+		}
+	}
+	if _, ok := s.users[id]; !ok {
+		return ErrUserNotFound
+	}
+
+	agreed := false
+	for _, agreement := range s.agreements {
+		if agreement.UserUUID == id && agreement.DocumentName == revocation.DocumentName && !agreement.Date.After(revocation.Date) {
+			agreed = true
+		}
+	}
+	if !agreed {
+		return ErrAgreementNotFound
+	}
+
+	s.revocations = append(s.revocations, revocation)
+	return nil
+}
+
+func (s *MemoryStore) GetRevocationsForUserUUID(ctx context.Context, userUUID string) ([]Revocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUUID(userUUID)
+	if err != nil {
+		return nil, err
+	}
+	revocations := []Revocation{}
+	for _, revocation := range s.revocations {
+		if revocation.UserUUID == id {
+			revocation.Reason = copyStr(revocation.Reason)
+			revocations = append(revocations, revocation)
+		}
+	}
+
+	sort.SliceStable(revocations, func(i, j int) bool {
+		return revocations[i].Date.Before(revocations[j].Date)
+	})
+	return revocations, nil
+}
+
+// GetStats counts the users who have not been erased, the agreements, and
+// for each document the users who have not agreed to the version currently
+// in force.
+func (s *MemoryStore) GetStats(ctx context.Context) (Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := contextError(ctx, ctx.Err()); err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Agreements:            len(s.agreements),
+		OutstandingByDocument: map[string]int{},
+	}
+	for _, user := range s.users {
+		if user.ErasedAt == nil {
+			stats.Users++
+		}
+	}
+	for _, name := range s.documentNames() {
+		if _, ok := s.currentVersion(name); !ok {
+			continue
+		}
+		stats.OutstandingByDocument[name] = 0
+		for _, user := range s.users {
+			if s.outstanding(user, name) {
+				stats.OutstandingByDocument[name]++
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (s *MemoryStore) documentNames() []string {
+	names := []string{}
+	for name := range s.documents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// versionAt returns the index of the version of a document that was the
+// latest version at the given time.
+func (s *MemoryStore) versionAt(name string, at time.Time) (int, bool) {
+	versions := s.documents[name]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].ValidFrom.After(at) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (s *MemoryStore) currentVersion(name string) (int, bool) {
+	return s.versionAt(name, time.Now())
+}
+
+func (s *MemoryStore) documentVersion(name string, i int) DocumentVersion {
+	agreed := map[string]bool{}
+	for _, agreement := range s.agreements {
+		if s.appliesTo(agreement, name, i) {
+			agreed[agreement.UserUUID] = true
+		}
+	}
+
+	version := s.documents[name][i]
+	return DocumentVersion{
+		Name:           version.Name,
+		Version:        i + 1,
+		Content:        version.Content,
+		ValidFrom:      version.ValidFrom,
+		ContentHash:    ContentHash(version.Content),
+		AgreementCount: len(agreed),
+	}
+}
+
+// appliesTo matches an agreement to the i-th version of a document in the
+// same way as agreementAppliesToVersion.
+func (s *MemoryStore) appliesTo(agreement Agreement, name string, i int) bool {
+	if agreement.DocumentName != name {
+		return false
+	}
+
+	if agreement.DocumentValidFrom != nil {
+		if !agreement.DocumentValidFrom.Equal(s.documents[name][i].ValidFrom) {
+			return false
+		}
+	} else if at, ok := s.versionAt(name, agreement.Date); !ok || at != i {
+		return false
+	}
+
+	for _, revocation := range s.revocations {
+		if revocation.UserUUID == agreement.UserUUID && revocation.DocumentName == name && !revocation.Date.Before(agreement.Date) {
+			return false
+		}
+	}
+	return true
+}
+
+// outstanding reports whether a user who has not been erased has yet to
+// agree to the version of a document currently in force.
+func (s *MemoryStore) outstanding(user User, name string) bool {
+	current, ok := s.currentVersion(name)
+	if !ok || user.ErasedAt != nil {
+		return false
+	}
+	for _, agreement := range s.agreements {
+		if agreement.UserUUID == user.UUID && s.appliesTo(agreement, name, current) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemoryStore) sortedUsers() []User {
+	users := []User{}
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UUID < users[j].UUID
+	})
+	return users
+}
+
+func (s *MemoryStore) usernameTaken(username *string, except string) bool {
+	if username == nil {
+		return false
+	}
+	for id, user := range s.users {
+		if id != except && user.Username != nil && *user.Username == *username {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUUID returns a UUID in the form Postgres returns it, or
+// ErrInvalidInput if Postgres would not accept it.
+func parseUUID(s string) (string, error) {
+	id, err := uuid.FromString(s)
+	if err != nil {
+		return "", ErrInvalidInput
+	}
+	return id.String(), nil
+}
+
+// timestamp rounds a time to the microsecond precision of a Postgres
+// timestamptz.
+func timestamp(t time.Time) time.Time {
+	return t.Round(time.Microsecond)
+}
+
+func duplicateKeyError(constraint string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint %q", constraint)
+}
+
+func page[T any](items []T, limit int, offset int) []T {
+	if offset > len(items) {
+		offset = len(items)
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func copyStr(str *string) *string {
+	if str == nil {
+		return nil
+	}
+	c := *str
+	return &c
+}
+
+func copyUser(user User) User {
+	user.Email = copyStr(user.Email)
+	user.Username = copyStr(user.Username)
+	if user.ErasedAt != nil {
+		erasedAt := *user.ErasedAt
+		user.ErasedAt = &erasedAt
+	}
+	return user
+}
+
+func copyAgreement(agreement Agreement) Agreement {
+	if agreement.DocumentValidFrom != nil {
+		validFrom := *agreement.DocumentValidFrom
+		agreement.DocumentValidFrom = &validFrom
+	}
+	agreement.DocumentContentHash = copyStr(agreement.DocumentContentHash)
+	agreement.Principal = copyStr(agreement.Principal)
+	agreement.Channel = copyStr(agreement.Channel)
+	agreement.ClientIP = copyStr(agreement.ClientIP)
+	agreement.UserAgent = copyStr(agreement.UserAgent)
+	return agreement
+}
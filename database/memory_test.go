@@ -0,0 +1,320 @@
+package database_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/alphagov/paas-accounts/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MemoryStore", func() {
+	var (
+		store      *MemoryStore
+		frozenTime time.Time
+		userUUID   string
+	)
+
+	BeforeEach(func() {
+		store = NewMemoryStore()
+		frozenTime = time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)
+		userUUID = "00000000-0000-0000-0000-000000000001"
+	})
+
+	Describe("Document", func() {
+		It("should put and get a document", func() {
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+
+			doc, err := store.GetDocument(ctx, "terms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc).To(Equal(Document{Name: "terms", Content: "v1", ValidFrom: frozenTime}))
+		})
+
+		It("should fail to put a document without a name, content or valid_from", func() {
+			Expect(store.PutDocument(ctx, Document{Content: "v1", ValidFrom: frozenTime})).To(MatchError(ErrInvalidInput))
+			Expect(store.PutDocument(ctx, Document{Name: "terms", ValidFrom: frozenTime})).To(MatchError(ErrInvalidInput))
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1"})).To(MatchError(ErrInvalidInput))
+		})
+
+		It("should keep document history linear", func() {
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+
+			err := store.PutDocument(ctx, Document{Name: "terms", Content: "v0", ValidFrom: frozenTime.Add(-time.Hour)})
+			Expect(err).To(MatchError(ErrDocumentHistoryConflict))
+			err = store.PutDocument(ctx, Document{Name: "terms", Content: "v0", ValidFrom: frozenTime})
+			Expect(err).To(MatchError(ErrDocumentHistoryConflict))
+		})
+
+		It("should not add a version if the content matches the latest version", func() {
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime.Add(time.Hour)})).To(Succeed())
+
+			versions, err := store.GetDocumentVersions(ctx, "terms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions).To(HaveLen(1))
+		})
+
+		It("should tell the current version from the upcoming one", func() {
+			upcoming := time.Now().Add(24 * time.Hour)
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v2", ValidFrom: upcoming})).To(Succeed())
+
+			doc, err := store.GetDocument(ctx, "terms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Content).To(Equal("v1"))
+
+			doc, err = store.GetUpcomingDocument(ctx, "terms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Content).To(Equal("v2"))
+
+			documents, err := store.GetDocuments(ctx, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(documents).To(HaveLen(1))
+			Expect(documents[0].VersionCount).To(Equal(2))
+			Expect(documents[0].ContentHash).To(Equal(ContentHash("v2")))
+		})
+
+		It("should fail to get a document that doesn't exist", func() {
+			_, err := store.GetDocument(ctx, "terms")
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+			_, err = store.GetDocumentVersions(ctx, "terms")
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+			_, err = store.GetUpcomingDocument(ctx, "terms")
+			Expect(err).To(MatchError(ErrDocumentNotFound))
+		})
+	})
+
+	Describe("User", func() {
+		It("should create a user only once", func() {
+			user := User{UUID: userUUID, Email: strPoint("Jeff@Example.com"), Username: strPoint("jeff")}
+			Expect(store.CreateUser(ctx, user)).To(Succeed())
+			Expect(store.CreateUser(ctx, user)).To(MatchError(ErrUserExists))
+			Expect(store.PostUser(ctx, user)).To(Succeed())
+
+			stored, err := store.GetUser(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*stored.Email).To(Equal("jeff@example.com"))
+		})
+
+		It("should not give two users the same username", func() {
+			Expect(store.CreateUser(ctx, User{UUID: userUUID, Username: strPoint("jeff")})).To(Succeed())
+
+			other := User{UUID: "00000000-0000-0000-0000-000000000002", Username: strPoint("jeff")}
+			Expect(store.CreateUser(ctx, other)).To(MatchError(ErrUsernameTaken))
+			Expect(store.PostUser(ctx, other)).To(MatchError(ErrUsernameTaken))
+		})
+
+		It("should fail to create a user without a valid uuid", func() {
+			Expect(store.CreateUser(ctx, User{UUID: "not-a-uuid"})).To(MatchError(ErrInvalidInput))
+		})
+
+		It("should fail to look up a user without a valid uuid", func() {
+			_, err := store.GetUser(ctx, "not-a-uuid")
+			Expect(err).To(MatchError(ErrInvalidInput))
+			_, err = store.GetUsersByUUID(ctx, []string{"not-a-uuid"})
+			Expect(err).To(MatchError(ErrInvalidInput))
+			_, err = store.GetAgreementsForUserUUID(ctx, "not-a-uuid")
+			Expect(err).To(MatchError(ErrInvalidInput))
+		})
+
+		It("should not restore the personal data of an erased user", func() {
+			Expect(store.CreateUser(ctx, User{UUID: userUUID, Username: strPoint("jeff")})).To(Succeed())
+
+			erased, err := store.EraseUser(ctx, userUUID, strPoint("admin"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(erased.Username).To(BeNil())
+			Expect(erased.ErasedAt).ToNot(BeNil())
+
+			Expect(store.PatchUser(ctx, User{UUID: userUUID, Username: strPoint("jeff")})).To(MatchError(ErrUserErased))
+
+			erasure, err := store.GetErasure(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(erasure.Date).To(Equal(*erased.ErasedAt))
+			Expect(*erasure.Principal).To(Equal("admin"))
+		})
+
+		It("should erase the personal data recorded with a user's agreements and revocations", func() {
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+			Expect(store.CreateUser(ctx, User{UUID: userUUID})).To(Succeed())
+			Expect(store.PutAgreement(ctx, Agreement{
+				UserUUID:     userUUID,
+				DocumentName: "terms",
+				Date:         frozenTime.Add(time.Hour),
+				Provenance:   Provenance{Principal: strPoint("paas-admin"), ClientIP: strPoint("203.0.113.1"), UserAgent: strPoint("Mozilla/5.0")},
+			})).To(Succeed())
+			Expect(store.PutRevocation(ctx, Revocation{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour), Reason: strPoint("personal")})).To(Succeed())
+
+			_, err := store.EraseUser(ctx, userUUID, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			agreements, err := store.GetAgreementsForUserUUID(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements[0].ClientIP).To(BeNil())
+			Expect(agreements[0].UserAgent).To(BeNil())
+			Expect(agreements[0].Principal).To(Equal(strPoint("paas-admin")))
+
+			revocations, err := store.GetRevocationsForUserUUID(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revocations[0].Reason).To(BeNil())
+		})
+
+		It("should return ErrUserNotFound when erasing a user that does not exist", func() {
+			_, err := store.EraseUser(ctx, userUUID, nil)
+			Expect(err).To(MatchError(ErrUserNotFound))
+		})
+
+		It("should not let callers change a stored user", func() {
+			Expect(store.CreateUser(ctx, User{UUID: userUUID, Username: strPoint("jeff")})).To(Succeed())
+
+			user, err := store.GetUser(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			*user.Username = "changed"
+
+			user, err = store.GetUser(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*user.Username).To(Equal("jeff"))
+		})
+	})
+
+	Describe("Agreement", func() {
+		BeforeEach(func() {
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(Succeed())
+			Expect(store.PutDocument(ctx, Document{Name: "terms", Content: "v2", ValidFrom: frozenTime.Add(time.Hour)})).To(Succeed())
+			Expect(store.PostUser(ctx, User{UUID: userUUID})).To(Succeed())
+		})
+
+		It("should not agree to a document before it exists", func() {
+			err := store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(-time.Second)})
+			Expect(err).To(MatchError(ErrAgreementDocumentNotFound))
+			err = store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "other", Date: frozenTime})
+			Expect(err).To(MatchError(ErrAgreementDocumentNotFound))
+		})
+
+		It("should not agree to a version that doesn't exist or has been superseded", func() {
+			missing := frozenTime.Add(time.Minute)
+			err := store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour), DocumentValidFrom: &missing})
+			Expect(err).To(MatchError(ErrAgreementDocumentNotFound))
+
+			err = store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour), DocumentValidFrom: &frozenTime})
+			Expect(err).To(MatchError(ErrAgreementDocumentSuperseded))
+		})
+
+		It("should record the content hash of the version agreed to", func() {
+			Expect(store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour)})).To(Succeed())
+
+			agreements, err := store.GetAgreementsForUserUUID(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements[0].DocumentContentHash).To(Equal(strPoint(ContentHash("v2"))))
+		})
+
+		It("should not agree with the content hash of another version", func() {
+			validFrom := frozenTime.Add(time.Hour)
+			err := store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour), DocumentValidFrom: &validFrom, DocumentContentHash: strPoint(ContentHash("v1"))})
+			Expect(err).To(MatchError(ErrAgreementDocumentHashMismatch))
+		})
+
+		It("should not agree for a user who doesn't exist", func() {
+			err := store.PutAgreement(ctx, Agreement{UserUUID: "00000000-0000-0000-0000-000000000002", DocumentName: "terms", Date: frozenTime})
+			Expect(err).To(MatchError(ErrUserNotFound))
+		})
+
+		It("should not record the same agreement twice", func() {
+			agreement := Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime}
+			Expect(store.PutAgreement(ctx, agreement)).To(Succeed())
+			Expect(store.PutAgreement(ctx, agreement)).To(MatchError(ContainSubstring("agreements_pkey")))
+		})
+
+		It("should not create a user when their agreement is rejected", func() {
+			newUUID := "00000000-0000-0000-0000-000000000002"
+			err := store.PutAgreementForUser(ctx, Agreement{UserUUID: newUUID, DocumentName: "other", Date: frozenTime})
+			Expect(err).To(MatchError(ErrAgreementDocumentNotFound))
+
+			_, err = store.GetUser(ctx, newUUID)
+			Expect(err).To(MatchError(ErrUserNotFound))
+
+			Expect(store.PutAgreementForUser(ctx, Agreement{UserUUID: newUUID, DocumentName: "terms", Date: frozenTime})).To(Succeed())
+			_, err = store.GetUser(ctx, newUUID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should match agreements to the version they were made against", func() {
+			Expect(store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(time.Minute)})).To(Succeed())
+
+			versions, err := store.GetDocumentVersions(ctx, "terms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions[0].AgreementCount).To(Equal(1))
+			Expect(versions[1].AgreementCount).To(Equal(0))
+
+			users, err := store.GetUsersWithOutstandingDocument(ctx, "terms", 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(HaveLen(1))
+
+			stats, err := store.GetStats(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(Equal(Stats{Users: 1, Agreements: 1, OutstandingByDocument: map[string]int{"terms": 1}}))
+		})
+
+		It("should revoke every earlier agreement to a document", func() {
+			Expect(store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour)})).To(Succeed())
+
+			Expect(store.PutRevocation(ctx, Revocation{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(time.Hour)})).To(MatchError(ErrAgreementNotFound))
+			Expect(store.PutRevocation(ctx, Revocation{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(3 * time.Hour)})).To(Succeed())
+
+			users, err := store.GetUsersWithOutstandingDocument(ctx, "terms", 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(HaveLen(1))
+
+			agreements, err := store.GetAgreementsForUserUUID(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+		})
+
+		It("should list the documents of a user, agreed to first", func() {
+			Expect(store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(2 * time.Hour), Provenance: Provenance{Channel: strPoint("web")}})).To(Succeed())
+
+			documents, err := store.GetDocumentsForUserUUID(ctx, userUUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(documents).To(HaveLen(2))
+			Expect(documents[0].Content).To(Equal("v2"))
+			Expect(*documents[0].AgreementDate).To(Equal(frozenTime.Add(2 * time.Hour)))
+			Expect(*documents[0].AgreementProvenance.Channel).To(Equal("web"))
+			Expect(documents[1].Content).To(Equal("v1"))
+			Expect(documents[1].AgreementDate).To(BeNil())
+		})
+
+		It("should filter and paginate agreements", func() {
+			for i := 1; i <= 3; i++ {
+				Expect(store.PutAgreement(ctx, Agreement{UserUUID: userUUID, DocumentName: "terms", Date: frozenTime.Add(time.Duration(i) * time.Hour)})).To(Succeed())
+			}
+
+			from := frozenTime.Add(2 * time.Hour)
+			agreements, err := store.FilterAgreementsForUserUUID(ctx, userUUID, AgreementFilter{From: &from})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(2))
+
+			agreements, err = store.FilterAgreementsForUserUUID(ctx, userUUID, AgreementFilter{Limit: 1, Offset: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(agreements).To(HaveLen(1))
+			Expect(agreements[0].Date).To(Equal(from))
+		})
+	})
+
+	Describe("Context", func() {
+		It("should report a cancelled context as ErrCanceled", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			_, err := store.GetUser(cancelled, userUUID)
+			Expect(err).To(MatchError(ErrCanceled))
+		})
+
+		It("should report an expired context as ErrTimeout", func() {
+			expired, cancel := context.WithTimeout(ctx, -time.Second)
+			defer cancel()
+
+			Expect(store.PutDocument(expired, Document{Name: "terms", Content: "v1", ValidFrom: frozenTime})).To(MatchError(ErrTimeout))
+		})
+	})
+})
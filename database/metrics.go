@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Stats are counts of what the database holds, for monitoring.
+type Stats struct {
+	Users                 int
+	Agreements            int
+	OutstandingByDocument map[string]int
+}
+
+func newQueryDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "paas_accounts_database_query_duration_seconds",
+		Help:    "Time taken by each method of the database, including any retries and transactions.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+}
+
+// observe records how long a method took.
+func (db *DB) observe(method string, start time.Time) {
+	db.queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// Collectors returns the Prometheus collectors for the database: the
+// duration of each method, the connection pool stats and the counts in
+// Stats.
+func (db *DB) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		db.queryDuration,
+		collectors.NewDBStatsCollector(db.conn, "paas_accounts"),
+		&statsCollector{db: db, interval: db.statsInterval},
+	}
+}
+
+// GetStats counts the users who have not been erased, the agreements, and
+// for each document the users who have not agreed to the version currently
+// in force.
+func (db *DB) GetStats(ctx context.Context) (_ Stats, err error) {
+	ctx, end := db.begin(ctx, "GetStats")
+	defer end(&err)
+
+	stats := Stats{OutstandingByDocument: map[string]int{}}
+	err = db.conn.QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) FROM users WHERE erased_at IS NULL),
+			(SELECT count(*) FROM agreements)
+	`).Scan(&stats.Users, &stats.Agreements)
+	if err != nil {
+		return stats, err
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		WITH valid_documents AS (`+validDocumentsQuery+`)
+		SELECT
+			d.name, count(u.uuid)
+		FROM
+			valid_documents d
+		LEFT JOIN
+			users u ON (
+				u.erased_at IS NULL
+				AND NOT EXISTS (
+					SELECT
+						1
+					FROM
+						agreements
+					WHERE
+						agreements.user_uuid = u.uuid
+						AND `+agreementAppliesToVersion+`
+				)
+			)
+		WHERE
+			d.valid_for @> now()
+		GROUP BY
+			d.name
+	`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return stats, err
+		}
+		stats.OutstandingByDocument[name] = count
+	}
+
+	return stats, rows.Err()
+}
+
+var (
+	usersDesc = prometheus.NewDesc(
+		"paas_accounts_users",
+		"Number of users who have not been erased.",
+		nil, nil,
+	)
+	agreementsDesc = prometheus.NewDesc(
+		"paas_accounts_agreements",
+		"Number of agreements.",
+		nil, nil,
+	)
+	outstandingDesc = prometheus.NewDesc(
+		"paas_accounts_outstanding_agreements",
+		"Number of users who have not agreed to the version of a document currently in force.",
+		[]string{"document"}, nil,
+	)
+	statsErrorsDesc = prometheus.NewDesc(
+		"paas_accounts_stats_errors",
+		"1 if the counts could not be read from the database when they were last read.",
+		nil, nil,
+	)
+)
+
+// statsTimeout limits how long reading the counts in Stats may take, even if
+// the DB has no query timeout, as scrapes must not pile up behind it.
+const statsTimeout = 30 * time.Second
+
+// statsCollector reads the counts in Stats from the database when scraped,
+// reusing them for the interval so that frequent scrapes do not add load to
+// the database. Scrapes at the same time wait for a single read.
+type statsCollector struct {
+	db       *DB
+	interval time.Duration
+
+	mu     sync.Mutex
+	stats  Stats
+	err    error
+	readAt time.Time
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+	ch <- agreementsDesc
+	ch <- outstandingDesc
+	ch <- statsErrorsDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.read()
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(statsErrorsDesc, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(statsErrorsDesc, prometheus.GaugeValue, 0)
+
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(stats.Users))
+	ch <- prometheus.MustNewConstMetric(agreementsDesc, prometheus.GaugeValue, float64(stats.Agreements))
+	for document, count := range stats.OutstandingByDocument {
+		ch <- prometheus.MustNewConstMetric(outstandingDesc, prometheus.GaugeValue, float64(count), document)
+	}
+}
+
+// read returns the counts read within the interval, or else reads them.
+func (c *statsCollector) read() (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.readAt.IsZero() && time.Since(c.readAt) < c.interval {
+		return c.stats, c.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	c.stats, c.err = c.db.GetStats(ctx)
+	c.readAt = time.Now()
+	return c.stats, c.err
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/lib/pq"
+)
+
+// Migration is one of the migrations in sql/.
+type Migration struct {
+	Version uint
+	Name    string
+}
+
+// Migrations returns the migrations built into the binary, oldest first.
+func Migrations() ([]Migration, error) {
+	sourceDriver, err := iofs.New(sqlFs, "sql")
+	if err != nil {
+		return nil, err
+	}
+	defer sourceDriver.Close()
+
+	migrations := []Migration{}
+	version, err := sourceDriver.First()
+	for err == nil {
+		r, name, err := sourceDriver.ReadUp(version)
+		if err != nil {
+			return nil, err
+		}
+		r.Close()
+		migrations = append(migrations, Migration{Version: version, Name: name})
+
+		version, err = sourceDriver.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return migrations, nil
+		}
+	}
+	return nil, err
+}
+
+// LatestMigrationVersion returns the version of the newest migration built
+// into the binary, which the database is migrated to by Init.
+func LatestMigrationVersion() (uint, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, errors.New("no migrations")
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+func (db *DB) migrator() (*migrate.Migrate, error) {
+	sourceDriver, err := iofs.New(sqlFs, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewWithSourceInstance("iofs", sourceDriver, db.connstr)
+}
+
+// withMigrator runs fn with a golang-migrate instance for the database,
+// treating a migration that changes nothing as a success.
+func (db *DB) withMigrator(fn func(m *migrate.Migrate) error) error {
+	m, err := db.migrator()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := fn(m); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+// MigrateUp applies every migration that has not been applied yet.
+func (db *DB) MigrateUp() error {
+	return db.withMigrator(func(m *migrate.Migrate) error {
+		return m.Up()
+	})
+}
+
+// MigrateDown rolls back the newest n migrations that have been applied,
+// using their .down.sql files.
+func (db *DB) MigrateDown(n int) error {
+	if n < 1 {
+		return fmt.Errorf("the number of migrations to roll back must be at least 1, not %d", n)
+	}
+	return db.withMigrator(func(m *migrate.Migrate) error {
+		return m.Steps(-n)
+	})
+}
+
+// MigrateTo applies or rolls back migrations until the database is at a
+// version.
+func (db *DB) MigrateTo(version uint) error {
+	if err := checkMigrationVersion(version); err != nil {
+		return err
+	}
+	return db.withMigrator(func(m *migrate.Migrate) error {
+		return m.Migrate(version)
+	})
+}
+
+// ForceMigrationVersion records that the database is at a version, and is
+// not dirty, without running any migrations. It is for recovering from a
+// migration that failed part way through, once the database has been fixed
+// by hand.
+func (db *DB) ForceMigrationVersion(version uint) error {
+	if err := checkMigrationVersion(version); err != nil {
+		return err
+	}
+	return db.withMigrator(func(m *migrate.Migrate) error {
+		return m.Force(int(version))
+	})
+}
+
+func checkMigrationVersion(version uint) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no migration %d", version)
+}
+
+// MigrationVersion returns the version the database has been migrated to,
+// as recorded by golang-migrate, and whether the last migration failed part
+// way through. A database that has never been migrated is at version 0.
+func (db *DB) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := db.conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "undefined_table" {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
@@ -0,0 +1,122 @@
+package database_test
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	. "github.com/alphagov/paas-accounts/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrations", func() {
+	It("should return the version of the newest migration", func() {
+		files, err := filepath.Glob("sql/*.up.sql")
+		Expect(err).ToNot(HaveOccurred())
+
+		var newest uint
+		for _, file := range files {
+			version, err := strconv.ParseUint(strings.SplitN(filepath.Base(file), "_", 2)[0], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			if uint(version) > newest {
+				newest = uint(version)
+			}
+		}
+
+		Expect(LatestMigrationVersion()).To(Equal(newest))
+	})
+
+	It("should list the migrations oldest first", func() {
+		migrations, err := Migrations()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(migrations).ToNot(BeEmpty())
+		Expect(migrations[0]).To(Equal(Migration{Version: 1, Name: "init_documents"}))
+		for i := 1; i < len(migrations); i++ {
+			Expect(migrations[i].Version).To(BeNumerically(">", migrations[i-1].Version))
+		}
+	})
+
+	It("should refuse to move to a version that is not a migration", func() {
+		db, err := Open(Config{URL: "postgres://nobody@127.0.0.1:1/nothing?sslmode=disable"})
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		Expect(db.MigrateTo(999)).To(MatchError("there is no migration 999"))
+		Expect(db.ForceMigrationVersion(999)).To(MatchError("there is no migration 999"))
+		Expect(db.MigrateDown(0)).To(MatchError(ContainSubstring("at least 1")))
+	})
+
+	Context("with a database", func() {
+		var (
+			db     *DB
+			tempDB *TempDB
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDB, err = NewTempDB()
+			Expect(err).ToNot(HaveOccurred())
+
+			db, err = NewDB(tempDB.TempConnectionString)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			db.Close()
+			Expect(tempDB.Close()).To(Succeed())
+		})
+
+		It("should be at version 0 before it is migrated", func() {
+			version, dirty, err := db.MigrationVersion(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(BeZero())
+			Expect(dirty).To(BeFalse())
+		})
+
+		It("should be at the newest version once it is migrated", func() {
+			Expect(db.Init()).To(Succeed())
+
+			version, dirty, err := db.MigrationVersion(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(mustLatestMigrationVersion()))
+			Expect(dirty).To(BeFalse())
+		})
+
+		It("should roll back and reapply migrations", func() {
+			latest := mustLatestMigrationVersion()
+			Expect(db.MigrateUp()).To(Succeed())
+			Expect(db.MigrateUp()).To(Succeed(), "nothing to apply is not an error")
+
+			Expect(db.MigrateDown(2)).To(Succeed())
+			version, _, err := db.MigrationVersion(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(latest - 2))
+
+			Expect(db.MigrateTo(latest)).To(Succeed())
+			version, _, err = db.MigrationVersion(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(latest))
+		})
+
+		It("should force the version without running migrations", func() {
+			Expect(db.MigrateTo(1)).To(Succeed())
+			Expect(db.ForceMigrationVersion(2)).To(Succeed())
+
+			version, dirty, err := db.MigrationVersion(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(BeEquivalentTo(2))
+			Expect(dirty).To(BeFalse())
+
+			_, err = db.GetUser(ctx, "00000000-0000-0000-0000-000000000001")
+			Expect(err).To(HaveOccurred(), "the users table was never created")
+		})
+	})
+})
+
+func mustLatestMigrationVersion() uint {
+	version, err := LatestMigrationVersion()
+	Expect(err).ToNot(HaveOccurred())
+	return version
+}
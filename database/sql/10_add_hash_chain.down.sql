@@ -0,0 +1,20 @@
+DROP TRIGGER set_agreements_chain_tgr ON agreements;
+DROP FUNCTION set_agreements_chain();
+DROP TRIGGER set_documents_chain_tgr ON documents;
+DROP FUNCTION set_documents_chain();
+DROP FUNCTION next_chain_link(text);
+DROP FUNCTION chain_genesis();
+DROP FUNCTION chain_link_hash(text, bigint, text);
+DROP FUNCTION agreement_chain_record(agreements);
+DROP FUNCTION document_chain_record(documents);
+DROP FUNCTION chain_time(timestamptz);
+DROP FUNCTION chain_field(text);
+DROP FUNCTION sha256_hex(text);
+
+ALTER TABLE agreements
+  DROP COLUMN seq,
+  DROP COLUMN chain_hash;
+ALTER TABLE documents
+  DROP COLUMN content_hash,
+  DROP COLUMN seq,
+  DROP COLUMN chain_hash;
@@ -0,0 +1,165 @@
+-- Each document version records the SHA-256 hash of its content, and each
+-- agreement the hash of the version it applies to. Documents and agreements
+-- are also linked, in the order they were added, in a single chain: seq is a
+-- row's place in it, and chain_hash covers the row and the chain_hash of the
+-- row before it, so changing or removing a row breaks the chain from there
+-- on. chain.go checks the chain, and must hash rows in the same way.
+ALTER TABLE documents
+  ADD COLUMN content_hash text,
+  ADD COLUMN seq bigint,
+  ADD COLUMN chain_hash text;
+ALTER TABLE agreements
+  ADD COLUMN seq bigint,
+  ADD COLUMN chain_hash text;
+
+CREATE FUNCTION sha256_hex(value text) RETURNS text AS $$
+  SELECT encode(sha256(convert_to(value, 'UTF8')), 'hex')
+$$ LANGUAGE sql IMMUTABLE STRICT;
+
+-- encode a value so that different lists of values are never encoded the same
+CREATE FUNCTION chain_field(value text) RETURNS text AS $$
+  SELECT CASE WHEN value IS NULL THEN 'N;' ELSE octet_length(value) || ':' || value || ';' END
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION chain_time(value timestamptz) RETURNS text AS $$
+  SELECT chain_field(to_char(value AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'))
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION document_chain_record(d documents) RETURNS text AS $$
+  SELECT chain_field('document') || chain_field(d.name) || chain_time(d.valid_from) || chain_field(d.content_hash)
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION agreement_chain_record(a agreements) RETURNS text AS $$
+  SELECT chain_field('agreement') || chain_field(a.user_uuid::text) || chain_field(a.document_name) || chain_time(a.date)
+    || chain_time(a.document_valid_from) || chain_field(a.document_content_hash)
+    || chain_field(a.principal) || chain_field(a.channel) || chain_field(a.client_ip) || chain_field(a.user_agent)
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION chain_link_hash(previous text, seq bigint, chain_record text) RETURNS text AS $$
+  SELECT sha256_hex(chain_field(previous) || chain_field(seq::text) || chain_record)
+$$ LANGUAGE sql IMMUTABLE;
+
+-- the chain_hash before the first row
+CREATE FUNCTION chain_genesis() RETURNS text AS $$
+  SELECT repeat('0', 64)
+$$ LANGUAGE sql IMMUTABLE;
+
+-- backfill the hashes and the chain, in the order rows are most likely to have
+-- been added, with the triggers that stop rows being changed disabled
+ALTER TABLE documents DISABLE TRIGGER check_documents_immutable_tgr;
+ALTER TABLE agreements DISABLE TRIGGER check_agreements_immutable_tgr;
+
+UPDATE documents SET content_hash = sha256_hex(content);
+
+UPDATE agreements a SET document_content_hash = (
+  SELECT d.content_hash FROM documents d
+  WHERE d.name = a.document_name AND (
+    d.valid_from = a.document_valid_from
+    OR (a.document_valid_from IS NULL AND d.valid_from <= a.date)
+  )
+  ORDER BY d.valid_from DESC
+  LIMIT 1
+)
+WHERE a.document_content_hash IS NULL;
+
+DO $$
+  DECLARE
+    r record;
+    n bigint := 0;
+    head text := chain_genesis();
+  BEGIN
+    FOR r IN
+      SELECT 0 AS kind, d.name AS document_name, NULL::uuid AS user_uuid, d.valid_from AS at, document_chain_record(d) AS chain_record FROM documents d
+      UNION ALL
+      SELECT 1, a.document_name, a.user_uuid, a.date, agreement_chain_record(a) FROM agreements a
+      ORDER BY at, kind, document_name, user_uuid
+    LOOP
+      n := n + 1;
+      head := chain_link_hash(head, n, r.chain_record);
+      IF r.kind = 0 THEN
+        UPDATE documents SET seq = n, chain_hash = head WHERE name = r.document_name AND valid_from = r.at;
+      ELSE
+        UPDATE agreements SET seq = n, chain_hash = head WHERE user_uuid = r.user_uuid AND document_name = r.document_name AND date = r.at;
+      END IF;
+    END LOOP;
+  END
+$$;
+
+ALTER TABLE documents ENABLE TRIGGER check_documents_immutable_tgr;
+ALTER TABLE agreements ENABLE TRIGGER check_agreements_immutable_tgr;
+
+ALTER TABLE documents
+  ALTER COLUMN content_hash SET NOT NULL,
+  ALTER COLUMN seq SET NOT NULL,
+  ALTER COLUMN chain_hash SET NOT NULL,
+  ADD CONSTRAINT documents_seq_key UNIQUE (seq);
+ALTER TABLE agreements
+  ALTER COLUMN seq SET NOT NULL,
+  ALTER COLUMN chain_hash SET NOT NULL,
+  ADD CONSTRAINT agreements_seq_key UNIQUE (seq);
+
+-- returns the seq and chain_hash of a row added to the end of the chain. The
+-- advisory lock makes writers wait for each other until their transactions
+-- end, so that each read of the head of the chain sees the row added before
+-- it. This relies on the default read committed isolation level.
+CREATE FUNCTION next_chain_link(chain_record text, OUT next_seq bigint, OUT next_hash text) AS $$
+  DECLARE
+    head_seq bigint;
+    head_hash text;
+  BEGIN
+    PERFORM pg_advisory_xact_lock(4815162342);
+
+    SELECT c.seq, c.chain_hash INTO head_seq, head_hash FROM (
+      (SELECT d.seq, d.chain_hash FROM documents d ORDER BY d.seq DESC LIMIT 1)
+      UNION ALL
+      (SELECT a.seq, a.chain_hash FROM agreements a ORDER BY a.seq DESC LIMIT 1)
+    ) c
+    ORDER BY c.seq DESC
+    LIMIT 1;
+
+    next_seq := coalesce(head_seq, 0) + 1;
+    next_hash := chain_link_hash(coalesce(head_hash, chain_genesis()), next_seq, chain_record);
+  END
+$$ LANGUAGE plpgsql;
+
+-- hash a new document and add it to the chain
+CREATE FUNCTION set_documents_chain() RETURNS TRIGGER AS $$
+  BEGIN
+    NEW.content_hash := sha256_hex(NEW.content);
+    SELECT l.next_seq, l.next_hash INTO NEW.seq, NEW.chain_hash FROM next_chain_link(document_chain_record(NEW)) l;
+    RETURN NEW;
+  END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER set_documents_chain_tgr
+    BEFORE INSERT ON documents
+    FOR EACH ROW
+    EXECUTE PROCEDURE set_documents_chain();
+
+-- record the hash of the document version a new agreement applies to, or
+-- ensure it is the hash given, and add the agreement to the chain
+CREATE FUNCTION set_agreements_chain() RETURNS TRIGGER AS $$
+  DECLARE
+    version_hash text;
+  BEGIN
+    SELECT d.content_hash INTO version_hash FROM documents d
+    WHERE d.name = NEW.document_name AND (
+      d.valid_from = NEW.document_valid_from
+      OR (NEW.document_valid_from IS NULL AND d.valid_from <= NEW.date)
+    )
+    ORDER BY d.valid_from DESC
+    LIMIT 1;
+
+    IF NEW.document_content_hash IS NULL THEN
+      NEW.document_content_hash := version_hash;
+    ELSIF version_hash IS NOT NULL AND NEW.document_content_hash <> version_hash THEN
+      RAISE EXCEPTION 'agreements_document_hash_mismatch';
+    END IF;
+
+    SELECT l.next_seq, l.next_hash INTO NEW.seq, NEW.chain_hash FROM next_chain_link(agreement_chain_record(NEW)) l;
+    RETURN NEW;
+  END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER set_agreements_chain_tgr
+    BEFORE INSERT ON agreements
+    FOR EACH ROW
+    EXECUTE PROCEDURE set_agreements_chain();
@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION check_agreement_revocations_immutable() RETURNS TRIGGER AS $$
+  BEGIN
+    RAISE EXCEPTION 'agreement_revocations_cannot_be_modified';
+  END
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION check_agreements_immutable() RETURNS TRIGGER AS $$
+  BEGIN
+    RAISE EXCEPTION 'agreements_cannot_be_modified';
+  END
+$$ LANGUAGE plpgsql;
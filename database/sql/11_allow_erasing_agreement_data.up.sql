@@ -0,0 +1,27 @@
+-- allow the personal data recorded with the agreements and revocations of an
+-- erased user to be removed, and nothing else about them to be changed
+CREATE OR REPLACE FUNCTION check_agreements_immutable() RETURNS TRIGGER AS $$
+  BEGIN
+    IF TG_OP = 'UPDATE'
+      AND NEW.client_ip IS NULL AND NEW.user_agent IS NULL
+      AND to_jsonb(NEW) - 'client_ip' - 'user_agent' = to_jsonb(OLD) - 'client_ip' - 'user_agent'
+      AND EXISTS (SELECT 1 FROM users WHERE uuid = OLD.user_uuid AND erased_at IS NOT NULL)
+    THEN
+      RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'agreements_cannot_be_modified';
+  END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION check_agreement_revocations_immutable() RETURNS TRIGGER AS $$
+  BEGIN
+    IF TG_OP = 'UPDATE'
+      AND NEW.reason IS NULL
+      AND to_jsonb(NEW) - 'reason' = to_jsonb(OLD) - 'reason'
+      AND EXISTS (SELECT 1 FROM users WHERE uuid = OLD.user_uuid AND erased_at IS NOT NULL)
+    THEN
+      RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'agreement_revocations_cannot_be_modified';
+  END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,37 @@
+CREATE OR REPLACE FUNCTION agreement_chain_record(a agreements) RETURNS text AS $$
+  SELECT chain_field('agreement') || chain_field(a.user_uuid::text) || chain_field(a.document_name) || chain_time(a.date)
+    || chain_time(a.document_valid_from) || chain_field(a.document_content_hash)
+    || chain_field(a.principal) || chain_field(a.channel) || chain_field(a.client_ip) || chain_field(a.user_agent)
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE documents DISABLE TRIGGER check_documents_immutable_tgr;
+ALTER TABLE agreements DISABLE TRIGGER check_agreements_immutable_tgr;
+
+UPDATE documents SET seq = -seq;
+UPDATE agreements SET seq = -seq;
+
+DO $$
+  DECLARE
+    r record;
+    n bigint := 0;
+    head text := chain_genesis();
+  BEGIN
+    FOR r IN
+      SELECT 0 AS kind, d.name AS document_name, NULL::uuid AS user_uuid, d.valid_from AS at, document_chain_record(d) AS chain_record FROM documents d
+      UNION ALL
+      SELECT 1, a.document_name, a.user_uuid, a.date, agreement_chain_record(a) FROM agreements a
+      ORDER BY at, kind, document_name, user_uuid
+    LOOP
+      n := n + 1;
+      head := chain_link_hash(head, n, r.chain_record);
+      IF r.kind = 0 THEN
+        UPDATE documents SET seq = n, chain_hash = head WHERE name = r.document_name AND valid_from = r.at;
+      ELSE
+        UPDATE agreements SET seq = n, chain_hash = head WHERE user_uuid = r.user_uuid AND document_name = r.document_name AND date = r.at;
+      END IF;
+    END LOOP;
+  END
+$$;
+
+ALTER TABLE documents ENABLE TRIGGER check_documents_immutable_tgr;
+ALTER TABLE agreements ENABLE TRIGGER check_agreements_immutable_tgr;
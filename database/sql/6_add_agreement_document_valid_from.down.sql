@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION check_agreements_document() RETURNS TRIGGER AS $$
+  BEGIN
+    IF NOT EXISTS (SELECT 1 FROM documents WHERE name = NEW.document_name AND valid_from <= NEW.date) THEN
+      RAISE EXCEPTION 'agreements_document_not_exist';
+    END IF;
+    RETURN NEW;
+  END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE agreements DROP COLUMN document_valid_from;
@@ -0,0 +1,21 @@
+ALTER TABLE agreements ADD COLUMN document_valid_from timestamptz;
+
+-- ensure a document exists with that name at that time, or, when the agreement
+-- names a specific version, that the version exists and has not been superseded
+CREATE OR REPLACE FUNCTION check_agreements_document() RETURNS TRIGGER AS $$
+  BEGIN
+    IF NEW.document_valid_from IS NULL THEN
+      IF NOT EXISTS (SELECT 1 FROM documents WHERE name = NEW.document_name AND valid_from <= NEW.date) THEN
+        RAISE EXCEPTION 'agreements_document_not_exist';
+      END IF;
+    ELSE
+      IF NOT EXISTS (SELECT 1 FROM documents WHERE name = NEW.document_name AND valid_from = NEW.document_valid_from) THEN
+        RAISE EXCEPTION 'agreements_document_not_exist';
+      END IF;
+      IF EXISTS (SELECT 1 FROM documents WHERE name = NEW.document_name AND valid_from > NEW.document_valid_from AND valid_from <= NEW.date) THEN
+        RAISE EXCEPTION 'agreements_document_superseded';
+      END IF;
+    END IF;
+    RETURN NEW;
+  END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,3 @@
+DROP TABLE agreement_revocations;
+DROP FUNCTION check_agreement_revocations_agreement();
+DROP FUNCTION check_agreement_revocations_immutable();
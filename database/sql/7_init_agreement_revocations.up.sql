@@ -0,0 +1,33 @@
+CREATE TABLE agreement_revocations (
+  user_uuid uuid not null references users (uuid) on delete restrict on update restrict,
+  document_name text not null,
+  date timestamptz not null check (date > 'epoch'::timestamptz),
+  reason text,
+
+  primary key (user_uuid, document_name, date)
+);
+
+-- ensure the user has agreed to the document before the revocation
+CREATE FUNCTION check_agreement_revocations_agreement() RETURNS TRIGGER AS $$
+  BEGIN
+    IF NOT EXISTS (SELECT 1 FROM agreements WHERE user_uuid = NEW.user_uuid AND document_name = NEW.document_name AND date <= NEW.date) THEN
+      RAISE EXCEPTION 'agreement_revocations_agreement_not_exist';
+    END IF;
+    RETURN NEW;
+  END
+$$ LANGUAGE plpgsql;
+CREATE CONSTRAINT TRIGGER check_agreement_revocations_agreement_tgr
+    AFTER INSERT ON agreement_revocations
+    FOR EACH ROW
+    EXECUTE PROCEDURE check_agreement_revocations_agreement();
+
+-- make it impossible to update/delete revocations
+CREATE FUNCTION check_agreement_revocations_immutable() RETURNS TRIGGER AS $$
+  BEGIN
+    RAISE EXCEPTION 'agreement_revocations_cannot_be_modified';
+  END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER check_agreement_revocations_immutable_tgr
+    BEFORE UPDATE OR DELETE ON agreement_revocations
+    FOR EACH ROW
+    EXECUTE PROCEDURE check_agreement_revocations_immutable();
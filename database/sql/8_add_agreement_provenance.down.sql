@@ -0,0 +1,6 @@
+ALTER TABLE agreements
+  DROP COLUMN document_content_hash,
+  DROP COLUMN principal,
+  DROP COLUMN channel,
+  DROP COLUMN client_ip,
+  DROP COLUMN user_agent;
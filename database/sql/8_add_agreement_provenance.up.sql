@@ -0,0 +1,6 @@
+ALTER TABLE agreements
+  ADD COLUMN document_content_hash text,
+  ADD COLUMN principal text,
+  ADD COLUMN channel text,
+  ADD COLUMN client_ip text,
+  ADD COLUMN user_agent text;
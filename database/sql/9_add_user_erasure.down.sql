@@ -0,0 +1,5 @@
+DROP TABLE user_erasures;
+DROP FUNCTION check_user_erasures_immutable();
+DROP TRIGGER check_users_erased_tgr ON users;
+DROP FUNCTION check_users_erased();
+ALTER TABLE users DROP COLUMN erased_at;
@@ -0,0 +1,36 @@
+ALTER TABLE users ADD COLUMN erased_at timestamptz;
+
+CREATE TABLE user_erasures (
+  user_uuid uuid primary key references users (uuid) on delete restrict on update restrict,
+  date timestamptz not null check (date > 'epoch'::timestamptz),
+  principal text
+);
+
+-- make it impossible to restore the personal data of an erased user
+CREATE FUNCTION check_users_erased() RETURNS TRIGGER AS $$
+  BEGIN
+    IF OLD.erased_at IS NOT NULL AND (
+      NEW.email IS NOT NULL
+      OR NEW.username IS NOT NULL
+      OR NEW.erased_at IS DISTINCT FROM OLD.erased_at
+    ) THEN
+      RAISE EXCEPTION 'users_erased';
+    END IF;
+    RETURN NEW;
+  END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER check_users_erased_tgr
+    BEFORE UPDATE ON users
+    FOR EACH ROW
+    EXECUTE PROCEDURE check_users_erased();
+
+-- make it impossible to update/delete erasures
+CREATE FUNCTION check_user_erasures_immutable() RETURNS TRIGGER AS $$
+  BEGIN
+    RAISE EXCEPTION 'user_erasures_cannot_be_modified';
+  END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER check_user_erasures_immutable_tgr
+    BEFORE UPDATE OR DELETE ON user_erasures
+    FOR EACH ROW
+    EXECUTE PROCEDURE check_user_erasures_immutable();
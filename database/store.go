@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Store holds documents, users and the agreements users make to documents.
+// DB stores them in Postgres and MemoryStore keeps them in memory; both
+// reject the same writes with the same errors.
+type Store interface {
+	PutDocument(ctx context.Context, doc Document) error
+	GetDocument(ctx context.Context, name string) (Document, error)
+	GetUpcomingDocument(ctx context.Context, name string) (Document, error)
+	GetDocuments(ctx context.Context, updatedSince *time.Time) ([]DocumentSummary, error)
+	GetDocumentVersions(ctx context.Context, name string) ([]DocumentVersion, error)
+	GetDocumentVersion(ctx context.Context, name string, version int) (DocumentVersion, error)
+	GetDocumentVersionAt(ctx context.Context, name string, at time.Time) (DocumentVersion, error)
+	GetUsersWithOutstandingDocument(ctx context.Context, name string, limit int, offset int) ([]User, error)
+
+	PostUser(ctx context.Context, user User) error
+	CreateUser(ctx context.Context, user User) error
+	PatchUser(ctx context.Context, user User) error
+	EraseUser(ctx context.Context, uuid string, principal *string) (User, error)
+	GetErasure(ctx context.Context, uuid string) (*Erasure, error)
+	GetUser(ctx context.Context, uuid string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) ([]*User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUsersByUUID(ctx context.Context, uuids []string) ([]*User, error)
+
+	PutAgreement(ctx context.Context, agreement Agreement) error
+	PutAgreementForUser(ctx context.Context, agreement Agreement) error
+	GetDocumentsForUserUUID(ctx context.Context, uuid string) ([]UserDocument, error)
+	GetAgreementsForUserUUID(ctx context.Context, uuid string) ([]Agreement, error)
+	FilterAgreementsForUserUUID(ctx context.Context, uuid string, filter AgreementFilter) ([]Agreement, error)
+	PutRevocation(ctx context.Context, revocation Revocation) error
+	GetRevocationsForUserUUID(ctx context.Context, uuid string) ([]Revocation, error)
+
+	GetStats(ctx context.Context) (Stats, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,372 @@
+// Package diff compares two versions of a document line by line or word by
+// word, and formats the changes as a unified diff.
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type Op int
+
+const (
+	Keep Op = iota
+	Delete
+	Insert
+)
+
+// Edit is a line or word kept, deleted from the old version or inserted in
+// the new one. The Text of a line includes its newline, unless it is the last
+// line of a version that does not end with one.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the edits that turn a into b, keeping as many lines as
+// possible.
+func Lines(a, b string) []Edit {
+	return Compare(splitLines(a), splitLines(b))
+}
+
+var words = regexp.MustCompile(`\s+|\S+`)
+
+// Words returns the edits that turn a into b, keeping as many words as
+// possible. Runs of whitespace are compared as words of their own, but are
+// treated as changed when they fall between two changes, so that a phrase
+// that was reworded is one deletion and one insertion.
+func Words(a, b string) []Edit {
+	edits := Compare(words.FindAllString(a, -1), words.FindAllString(b, -1))
+
+	var joined []Edit
+	var deleted, inserted strings.Builder
+	flush := func() {
+		if deleted.Len() > 0 {
+			joined = append(joined, Edit{Delete, deleted.String()})
+		}
+		if inserted.Len() > 0 {
+			joined = append(joined, Edit{Insert, inserted.String()})
+		}
+		deleted.Reset()
+		inserted.Reset()
+	}
+	for i, edit := range edits {
+		between := i > 0 && i < len(edits)-1 && edits[i-1].Op != Keep && edits[i+1].Op != Keep
+		switch {
+		case edit.Op == Keep && between && strings.TrimSpace(edit.Text) == "":
+			deleted.WriteString(edit.Text)
+			inserted.WriteString(edit.Text)
+		case edit.Op == Keep:
+			flush()
+			if n := len(joined); n > 0 && joined[n-1].Op == Keep {
+				joined[n-1].Text += edit.Text
+			} else {
+				joined = append(joined, edit)
+			}
+		case edit.Op == Delete:
+			deleted.WriteString(edit.Text)
+		case edit.Op == Insert:
+			inserted.WriteString(edit.Text)
+		}
+	}
+	flush()
+	return joined
+}
+
+// Changed reports whether any of the edits is a deletion or insertion.
+func Changed(edits []Edit) bool {
+	for _, edit := range edits {
+		if edit.Op != Keep {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Compare returns the edits that turn a into b, keeping as many of them as
+// possible. It uses the linear space version of Myers' algorithm, so that the
+// word diff of a long document that has been reworded throughout fits in the
+// memory of the app. Within each run of changes, deletions come before
+// insertions.
+func Compare(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	edits = compare(edits, a, b)
+
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Keep {
+			i++
+			continue
+		}
+		end := i
+		for end < len(edits) && edits[end].Op != Keep {
+			end++
+		}
+		sort.SliceStable(edits[i:end], func(x, y int) bool {
+			return edits[i+x].Op == Delete && edits[i+y].Op == Insert
+		})
+		i = end
+	}
+	return edits
+}
+
+// compare appends the edits that turn a into b, splitting them at the middle
+// snake of a shortest edit script and comparing the parts before and after
+// it.
+func compare(edits []Edit, a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, s := range a[:prefix] {
+		edits = append(edits, Edit{Keep, s})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch {
+	case len(x) == 0:
+		for _, s := range y {
+			edits = append(edits, Edit{Insert, s})
+		}
+	case len(y) == 0:
+		for _, s := range x {
+			edits = append(edits, Edit{Delete, s})
+		}
+	default:
+		// With the common start and end trimmed, at least two edits are
+		// needed, so both parts are smaller than x and y
+		x0, y0, x1, y1 := middleSnake(x, y)
+		edits = compare(edits, x[:x0], y[:y0])
+		for _, s := range x[x0:x1] {
+			edits = append(edits, Edit{Keep, s})
+		}
+		edits = compare(edits, x[x1:], y[y1:])
+	}
+
+	for _, s := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Keep, s})
+	}
+	return edits
+}
+
+// middleSnake returns the start and end of the run of kept elements, possibly
+// empty, in the middle of a shortest edit script turning a into b. It
+// searches forwards from the start and backwards from the end at the same
+// time, keeping only the furthest point reached on each diagonal, until the
+// two searches meet.
+func middleSnake(a, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+
+	// forward[offset+k] is the furthest x reached from the start on the
+	// diagonal x-y = k, and backward[offset+k] the furthest reached from the
+	// end, counting back, on the diagonal with k counted back from delta
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+backward[offset+c] >= n {
+				return x0, y0, x, y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if c := delta - k; !odd && c >= -d && c <= d && x+forward[offset+c] >= n {
+				return n - x, m - y, n - x0, m - y0
+			}
+		}
+	}
+
+	// The searches always meet by the time limit is reached
+	panic("diff: no middle snake")
+}
+
+// Unified formats line edits as a unified diff, with context unchanged lines
+// around each change. It returns an empty string if nothing changed.
+func Unified(fromName, toName string, edits []Edit, context int) string {
+	return format(fromName, toName, edits, context, func(out *strings.Builder, changed []Edit) {
+		for _, edit := range changed {
+			if edit.Op == Delete {
+				writeLine(out, "-", edit.Text)
+			}
+		}
+		for _, edit := range changed {
+			if edit.Op == Insert {
+				writeLine(out, "+", edit.Text)
+			}
+		}
+	})
+}
+
+// WordUnified formats line edits as a unified diff like Unified, but shows
+// changed lines once, marking the words deleted from them with [-...-] and
+// those inserted with {+...+}, as git diff --word-diff does.
+func WordUnified(fromName, toName string, edits []Edit, context int) string {
+	return format(fromName, toName, edits, context, func(out *strings.Builder, changed []Edit) {
+		var a, b strings.Builder
+		for _, edit := range changed {
+			if edit.Op == Delete {
+				a.WriteString(edit.Text)
+			} else {
+				b.WriteString(edit.Text)
+			}
+		}
+
+		var line strings.Builder
+		for _, word := range Words(a.String(), b.String()) {
+			switch word.Op {
+			case Keep:
+				line.WriteString(word.Text)
+			case Delete:
+				line.WriteString("[-" + word.Text + "-]")
+			case Insert:
+				line.WriteString("{+" + word.Text + "+}")
+			}
+		}
+		text := line.String()
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		out.WriteString(text)
+	})
+}
+
+// format writes the header and hunks of a unified diff, leaving how each run
+// of changed lines is written to writeChanges. Unchanged lines are written
+// with a space in front of them.
+func format(fromName, toName string, edits []Edit, context int, writeChanges func(out *strings.Builder, changed []Edit)) string {
+	if !Changed(edits) {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// aLine and bLine are the line numbers, from 1, of each edit in the old
+	// and new versions
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	aLine[0], bLine[0] = 1, 1
+	for i, edit := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if edit.Op != Insert {
+			aLine[i+1]++
+		}
+		if edit.Op != Delete {
+			bLine[i+1]++
+		}
+	}
+
+	for start := 0; start < len(edits); {
+		first := start
+		for first < len(edits) && edits[first].Op == Keep {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+
+		// Extend the hunk until there are more than 2*context unchanged
+		// lines before the next change
+		end := first
+		for end < len(edits) {
+			next := end
+			for next < len(edits) && edits[next].Op != Keep {
+				next++
+			}
+			same := next
+			for same < len(edits) && edits[same].Op == Keep {
+				same++
+			}
+			end = next
+			if same == len(edits) || same-next > 2*context {
+				break
+			}
+			end = same
+		}
+
+		from := max(first-context, start)
+		to := min(end+context, len(edits))
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLine[from], aLine[to]-aLine[from]),
+			hunkRange(bLine[from], bLine[to]-bLine[from]))
+		for i := from; i < to; {
+			if edits[i].Op == Keep {
+				writeLine(&out, " ", edits[i].Text)
+				i++
+				continue
+			}
+			changed := i
+			for i < to && edits[i].Op != Keep {
+				i++
+			}
+			writeChanges(&out, edits[changed:i])
+		}
+		start = to
+	}
+
+	return out.String()
+}
+
+func writeLine(out *strings.Builder, prefix, text string) {
+	out.WriteString(prefix)
+	out.WriteString(text)
+	if !strings.HasSuffix(text, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		// An empty range refers to the line before it
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
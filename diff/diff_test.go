@@ -0,0 +1,182 @@
+package diff_test
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/alphagov/paas-accounts/diff"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lines", func() {
+	It("should keep the lines in common", func() {
+		Expect(Lines("a\nb\nc\n", "a\nx\nc\n")).To(Equal([]Edit{
+			{Keep, "a\n"},
+			{Delete, "b\n"},
+			{Insert, "x\n"},
+			{Keep, "c\n"},
+		}))
+	})
+
+	It("should compare versions that are empty", func() {
+		Expect(Lines("", "")).To(BeEmpty())
+		Expect(Lines("", "a\n")).To(Equal([]Edit{{Insert, "a\n"}}))
+		Expect(Lines("a\n", "")).To(Equal([]Edit{{Delete, "a\n"}}))
+	})
+
+	It("should treat a missing newline at the end as a change", func() {
+		Expect(Changed(Lines("a\nb", "a\nb\n"))).To(BeTrue())
+		Expect(Changed(Lines("a\nb\n", "a\nb\n"))).To(BeFalse())
+	})
+})
+
+var _ = Describe("Compare", func() {
+	versions := func(edits []Edit) ([]string, []string) {
+		var a, b []string
+		for _, edit := range edits {
+			if edit.Op != Insert {
+				a = append(a, edit.Text)
+			}
+			if edit.Op != Delete {
+				b = append(b, edit.Text)
+			}
+		}
+		return a, b
+	}
+
+	It("should keep as many elements as possible", func() {
+		a := strings.Split("abcabba", "")
+		b := strings.Split("cbabac", "")
+		edits := Compare(a, b)
+
+		oldVersion, newVersion := versions(edits)
+		Expect(oldVersion).To(Equal(a))
+		Expect(newVersion).To(Equal(b))
+
+		kept := 0
+		for _, edit := range edits {
+			if edit.Op == Keep {
+				kept++
+			}
+		}
+		Expect(kept).To(Equal(4))
+	})
+
+	It("should compare long versions that have changed throughout", func() {
+		var a, b []string
+		for i := 0; i < 5000; i++ {
+			a = append(a, fmt.Sprintf("old-%d", i))
+			b = append(b, fmt.Sprintf("new-%d", i))
+			if i%3 == 0 {
+				b[i] = a[i]
+			}
+		}
+
+		oldVersion, newVersion := versions(Compare(a, b))
+		Expect(oldVersion).To(Equal(a))
+		Expect(newVersion).To(Equal(b))
+	})
+})
+
+var _ = Describe("Words", func() {
+	It("should keep the words in common", func() {
+		Expect(Words("the quick brown fox", "the slow brown dog")).To(Equal([]Edit{
+			{Keep, "the "},
+			{Delete, "quick"},
+			{Insert, "slow"},
+			{Keep, " brown "},
+			{Delete, "fox"},
+			{Insert, "dog"},
+		}))
+	})
+
+	It("should join consecutive edits", func() {
+		Expect(Words("a b c", "a x y")).To(Equal([]Edit{
+			{Keep, "a "},
+			{Delete, "b c"},
+			{Insert, "x y"},
+		}))
+	})
+})
+
+var _ = Describe("Unified", func() {
+	lines := func(from, to int) string {
+		var s strings.Builder
+		for i := from; i <= to; i++ {
+			s.WriteString(string(rune('a'+i-1)) + "\n")
+		}
+		return s.String()
+	}
+
+	It("should be empty if nothing changed", func() {
+		Expect(Unified("old", "new", Lines("a\n", "a\n"), 3)).To(BeEmpty())
+	})
+
+	It("should show the changes with context", func() {
+		old := lines(1, 10)
+		new := strings.Replace(old, "e\n", "E\n", 1)
+
+		Expect(Unified("old", "new", Lines(old, new), 2)).To(Equal(
+			"--- old\n" +
+				"+++ new\n" +
+				"@@ -3,5 +3,5 @@\n" +
+				" c\n" +
+				" d\n" +
+				"-e\n" +
+				"+E\n" +
+				" f\n" +
+				" g\n",
+		))
+	})
+
+	It("should split changes far apart into separate hunks", func() {
+		old := lines(1, 20)
+		new := strings.Replace(strings.Replace(old, "b\n", "", 1), "s\n", "s\nS\n", 1)
+
+		Expect(Unified("old", "new", Lines(old, new), 1)).To(Equal(
+			"--- old\n" +
+				"+++ new\n" +
+				"@@ -1,3 +1,2 @@\n" +
+				" a\n" +
+				"-b\n" +
+				" c\n" +
+				"@@ -19,2 +18,3 @@\n" +
+				" s\n" +
+				"+S\n" +
+				" t\n",
+		))
+	})
+
+	It("should mark a missing newline at the end", func() {
+		Expect(Unified("old", "new", Lines("a", "b\n"), 3)).To(Equal(
+			"--- old\n" +
+				"+++ new\n" +
+				"@@ -1 +1 @@\n" +
+				"-a\n" +
+				"\\ No newline at end of file\n" +
+				"+b\n",
+		))
+	})
+
+	It("should number an empty version from 0", func() {
+		Expect(Unified("old", "new", Lines("", "a\n"), 3)).To(HavePrefix("--- old\n+++ new\n@@ -0,0 +1 @@\n"))
+	})
+
+	It("should mark the words changed in each line", func() {
+		old := "# Terms\n\nYou must pay within 30 days.\nWe will tell you.\n"
+		new := "# Terms\n\nYou must pay within 60 days.\nWe will tell you.\nA new line.\n"
+
+		Expect(WordUnified("old", "new", Lines(old, new), 1)).To(Equal(
+			"--- old\n" +
+				"+++ new\n" +
+				"@@ -2,3 +2,4 @@\n" +
+				" \n" +
+				"You must pay within [-30-]{+60+} days.\n" +
+				" We will tell you.\n" +
+				"{+A new line.\n+}" +
+				"\n",
+		))
+	})
+})
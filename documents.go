@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alphagov/paas-accounts/client"
+	"github.com/alphagov/paas-accounts/database"
+	"github.com/alphagov/paas-accounts/diff"
+)
+
+// documentsCommand runs `paas-accounts documents`, which manages documents
+// through the API of a running server rather than the database.
+func documentsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("a documents command is required\n%s", usage)
+	}
+	switch args[0] {
+	case "push":
+		return pushDocument(args[1:])
+	}
+	return fmt.Errorf("unknown documents command %q\n%s", args[0], usage)
+}
+
+// pushDocument uploads a markdown file as a new version of a document, after
+// showing how it differs from the newest version already uploaded.
+func pushDocument(args []string) error {
+	flags := flag.NewFlagSet("documents push", flag.ContinueOnError)
+	apiURL := flags.String("url", os.Getenv("ACCOUNTS_URL"), "the URL of the paas-accounts API, by default $ACCOUNTS_URL")
+	dryRun := flags.Bool("dry-run", false, "show the changes without uploading them")
+	validFromFlag := flags.String("valid-from", "", "an RFC3339 time in the future when the new version comes into force, by default straight away")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("documents push takes a NAME and a FILE\n%s", usage)
+	}
+	name, path := positional[0], positional[1]
+
+	if *apiURL == "" {
+		return errors.New("the API URL is required, set ACCOUNTS_URL or --url")
+	}
+	var validFrom time.Time
+	if *validFromFlag != "" {
+		validFrom, err = time.Parse(time.RFC3339, *validFromFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --valid-from: %s", err)
+		}
+		if !validFrom.After(time.Now()) {
+			return errors.New("--valid-from must be in the future")
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return fmt.Errorf("%s is empty", path)
+	}
+
+	api := client.New(*apiURL)
+	api.Username = os.Getenv("ACCOUNTS_USERNAME")
+	api.Password = os.Getenv("ACCOUNTS_PASSWORD")
+	api.Token = os.Getenv("ACCOUNTS_TOKEN")
+
+	// A new version has to come after any version already scheduled, so
+	// compare against that rather than the version in force
+	previous, err := api.GetUpcomingDocument(globalContext, name)
+	if errors.Is(err, client.ErrNotFound) {
+		previous, err = api.GetDocument(globalContext, name)
+	}
+	if errors.Is(err, client.ErrNotFound) {
+		fmt.Printf("%s does not exist yet, it will be created\n", name)
+	} else if err != nil {
+		return fmt.Errorf("cannot get %s: %s", name, err)
+	} else {
+		edits := diff.Lines(previous.Content, string(content))
+		if !diff.Changed(edits) {
+			return fmt.Errorf("%s is the same as the version of %s from %s, not uploading it", path, name, previous.ValidFrom.Format(time.RFC3339))
+		}
+		fromName := fmt.Sprintf("%s (%s)", name, previous.ValidFrom.Format(time.RFC3339))
+		fmt.Print(diff.Unified(fromName, path, edits, 3))
+	}
+
+	if *dryRun {
+		fmt.Println("dry run, not uploading")
+		return nil
+	}
+
+	err = api.PutDocument(globalContext, database.Document{
+		Name:      name,
+		Content:   string(content),
+		ValidFrom: validFrom,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot upload %s: %s", name, err)
+	}
+
+	if validFrom.IsZero() {
+		fmt.Printf("uploaded %s, it is now in force\n", name)
+	} else {
+		fmt.Printf("uploaded %s, it comes into force at %s\n", name, validFrom.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseInterspersed parses flags that come before, between or after the
+// positional arguments, which the flag package stops at.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
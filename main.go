@@ -6,9 +6,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
-	"github.com/alphagov/paas-accounts/api"
 	"github.com/alphagov/paas-accounts/database"
 )
 
@@ -26,32 +26,57 @@ func init() {
 	}()
 }
 
-func Main() error {
-	db, err := database.NewDB(os.Getenv("DATABASE_URL"))
-	if err != nil {
-		return err
+const usage = `usage:
+  paas-accounts [serve] [--no-migrate]
+  paas-accounts migrate status|up|down N|goto VERSION|force VERSION
+  paas-accounts documents push [--dry-run] [--valid-from TIME] [--url URL] NAME FILE
+  paas-accounts verify`
+
+// Main runs the command named by args, which is the server if there is none.
+func Main(args []string) error {
+	if len(args) == 0 {
+		return serve(nil)
+	}
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "migrate":
+		return migrateCommand(args[1:])
+	case "documents":
+		return documentsCommand(args[1:])
+	case "verify":
+		return verifyCommand(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Println(usage)
+		return nil
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return serve(args)
 	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
 
-	if err := db.Ping(); err != nil {
-		return err
+// openDB connects to the database configured in the environment.
+func openDB() (*database.DB, error) {
+	dbConfig, err := database.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %s", err)
 	}
 
-	if err := db.Init(); err != nil {
-		return err
+	db, err := database.Open(dbConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	server := api.NewServer(api.Config{
-		DB:                db,
-		BasicAuthUsername: os.Getenv("BASIC_AUTH_USERNAME"),
-		BasicAuthPassword: os.Getenv("BASIC_AUTH_PASSWORD"),
-	})
-	addr := fmt.Sprintf("0.0.0.0:%s", os.Getenv("PORT"))
-	fmt.Println("server started at", addr)
-	return api.ListenAndServe(globalContext, server, addr)
+	if err := db.Ping(globalContext); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 func main() {
-	if err := Main(); err != nil {
+	if err := Main(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,102 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alphagov/paas-accounts/diff"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// DiffHTML renders two versions of a document to HTML and shows the blocks
+// deleted from the first inside <del> and those inserted in the second
+// inside <ins>. Each paragraph, heading, table and list item is compared as
+// a whole.
+func DiffHTML(a, b string) (string, error) {
+	aBlocks, err := blocks(a)
+	if err != nil {
+		return "", err
+	}
+	bBlocks, err := blocks(b)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, edit := range diff.Compare(aBlocks, bBlocks) {
+		switch edit.Op {
+		case diff.Keep:
+			out.WriteString(edit.Text)
+		case diff.Delete:
+			out.WriteString(mark(edit.Text, "del"))
+		case diff.Insert:
+			out.WriteString(mark(edit.Text, "ins"))
+		}
+	}
+	return adjacentLists.ReplaceAllString(out.String(), ""), nil
+}
+
+// adjacentLists matches the end of a list followed by the start of another,
+// which are the boundaries between the items of a list that blocks split
+// up.
+var adjacentLists = regexp.MustCompile(`</ul>\n<ul>\n|</ol>\n<ol(?: start="[0-9]+")?>\n`)
+
+// blocks renders each top level block of a document to sanitised HTML. The
+// items of a list are rendered as lists of their own, so that a change to
+// one item does not mark the whole list as changed.
+func blocks(source string) ([]string, error) {
+	src := []byte(source)
+	document := converter.Parser().Parse(text.NewReader(src))
+
+	var out []string
+	for node := document.FirstChild(); node != nil; node = node.NextSibling() {
+		list, ok := node.(*ast.List)
+		if !ok {
+			html, err := renderNode(src, node)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, html)
+			continue
+		}
+
+		n := list.Start
+		for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+			html, err := renderNode(src, item)
+			if err != nil {
+				return nil, err
+			}
+			if list.IsOrdered() && n != 1 {
+				out = append(out, fmt.Sprintf("<ol start=\"%d\">\n%s</ol>\n", n, html))
+			} else if list.IsOrdered() {
+				out = append(out, "<ol>\n"+html+"</ol>\n")
+			} else {
+				out = append(out, "<ul>\n"+html+"</ul>\n")
+			}
+			n++
+		}
+	}
+	return out, nil
+}
+
+func renderNode(src []byte, node ast.Node) (string, error) {
+	var out bytes.Buffer
+	if err := converter.Renderer().Render(&out, src, node); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(out.String()), nil
+}
+
+// mark wraps a block in a <del> or <ins>, inside the <li> if it is a list
+// item so that the list stays valid.
+func mark(block, tag string) string {
+	start, end := "<"+tag+">", "</"+tag+">"
+	if first, last := strings.Index(block, "<li>"), strings.LastIndex(block, "</li>"); first >= 0 && last > first {
+		first += len("<li>")
+		return block[:first] + start + block[first:last] + end + block[last:]
+	}
+	return start + strings.TrimSuffix(block, "\n") + end + "\n"
+}
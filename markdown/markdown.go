@@ -0,0 +1,110 @@
+// Package markdown renders documents, which are stored as markdown, to HTML
+// that is safe to include in a page.
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var converter = goldmark.New(
+	goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.Linkify),
+)
+
+// policy only allows the elements goldmark produces for text, lists, tables
+// and links. Raw HTML in a document is already left out by goldmark, but is
+// sanitised as well in case that ever changes.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements(
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"p", "br", "hr", "blockquote", "pre", "code",
+		"em", "strong", "del",
+		"ul", "ol", "li",
+		"table", "thead", "tbody", "tr", "th", "td",
+		"a",
+	)
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoReferrerOnLinks(true)
+	p.AllowAttrs("start").Matching(regexp.MustCompile(`^[0-9]+$`)).OnElements("ol")
+	p.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	return p
+}()
+
+// HTML renders markdown to sanitised HTML.
+func HTML(source string) (string, error) {
+	var out bytes.Buffer
+	if err := converter.Convert([]byte(source), &out); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(out.String()), nil
+}
+
+// Renderer renders markdown to HTML, keeping the most recently used results.
+// Versions of documents cannot change, so callers key them by the document's
+// name and when the version came into force.
+type Renderer struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	recent  *list.List
+}
+
+type entry struct {
+	key  string
+	html string
+}
+
+// NewRenderer returns a Renderer that keeps up to size results.
+func NewRenderer(size int) *Renderer {
+	return &Renderer{
+		size:    size,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+// HTML returns the HTML for the source stored under key, rendering it if it
+// is not cached.
+func (r *Renderer) HTML(key, source string) (string, error) {
+	r.mu.Lock()
+	if element, ok := r.entries[key]; ok {
+		r.recent.MoveToFront(element)
+		r.mu.Unlock()
+		return element.Value.(*entry).html, nil
+	}
+	r.mu.Unlock()
+
+	html, err := HTML(source)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[key]; !ok && r.size > 0 {
+		r.entries[key] = r.recent.PushFront(&entry{key, html})
+		for r.recent.Len() > r.size {
+			oldest := r.recent.Back()
+			r.recent.Remove(oldest)
+			delete(r.entries, oldest.Value.(*entry).key)
+		}
+	}
+	return html, nil
+}
+
+// Len returns how many results are cached.
+func (r *Renderer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recent.Len()
+}
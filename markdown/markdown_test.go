@@ -0,0 +1,110 @@
+package markdown_test
+
+import (
+	"os"
+
+	. "github.com/alphagov/paas-accounts/markdown"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTML", func() {
+	It("should render markdown", func() {
+		html, err := HTML("Terms\n=====\n\n-   **one**\n-   [two](https://example.com)\n\n| a | b |\n|:-|-:|\n| 1 | 2 |\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(html).To(ContainSubstring("<h1>Terms</h1>"))
+		Expect(html).To(ContainSubstring("<li><strong>one</strong></li>"))
+		Expect(html).To(ContainSubstring(`<a href="https://example.com" rel="noreferrer">two</a>`))
+		Expect(html).To(ContainSubstring(`<th style="text-align: left">a</th>`))
+	})
+
+	It("should render the terms of use", func() {
+		source, err := os.ReadFile("../documents/terms-of-use.md")
+		Expect(err).ToNot(HaveOccurred())
+
+		html, err := HTML(string(source))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(html).To(HavePrefix("<h1>GOV.UK Platform as a Service (PaaS)</h1>"))
+		Expect(html).To(ContainSubstring(`<a href="mailto:gov-uk-paas-support@digital.cabinet-office.gov.uk"`))
+	})
+
+	DescribeTable("should remove anything unsafe",
+		func(source, unsafe string) {
+			html, err := HTML(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(html).ToNot(ContainSubstring(unsafe))
+		},
+		Entry("script", "hello\n\n<script>alert(1)</script>\n", "<script"),
+		Entry("inline HTML", "hello <img src=x onerror=alert(1)>", "<img"),
+		Entry("event handler", "hello <b onclick=alert(1)>there</b>", "onclick"),
+		Entry("javascript link", "[hello](javascript:alert(1))", "javascript:"),
+		Entry("data link", "[hello](data:text/html;base64,PHNjcmlwdD4=)", "data:"),
+		Entry("image", "![hello](https://example.com/tracker.png)", "<img"),
+	)
+})
+
+var _ = Describe("Renderer", func() {
+	It("should reuse the HTML for a key", func() {
+		renderer := NewRenderer(10)
+
+		html, err := renderer.HTML("terms@2001-01-01T00:00:00Z", "*one*")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(html).To(Equal("<p><em>one</em></p>\n"))
+
+		html, err = renderer.HTML("terms@2001-01-01T00:00:00Z", "ignored, since versions cannot change")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(html).To(Equal("<p><em>one</em></p>\n"))
+	})
+
+	It("should forget the least recently used HTML once it is full", func() {
+		renderer := NewRenderer(2)
+		renderer.HTML("a", "a")
+		renderer.HTML("b", "b")
+		renderer.HTML("a", "a")
+		renderer.HTML("c", "c")
+		Expect(renderer.Len()).To(Equal(2))
+
+		Expect(renderer.HTML("a", "new a")).To(Equal("<p>a</p>\n"))
+		Expect(renderer.HTML("b", "new b")).To(Equal("<p>new b</p>\n"))
+	})
+})
+
+var _ = Describe("DiffHTML", func() {
+	It("should mark the blocks that changed", func() {
+		html, err := DiffHTML(
+			"# Terms\n\nIntro.\n\n-   one\n\n-   two\n\n1. a\n2. b\n",
+			"# Terms\n\nNew intro.\n\n-   one\n\n-   TWO\n\n1. a\n2. b\n3. c\n",
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(html).To(Equal("<h1>Terms</h1>\n" +
+			"<del><p>Intro.</p></del>\n" +
+			"<ins><p>New intro.</p></ins>\n" +
+			"<ul>\n" +
+			"<li>\n<p>one</p>\n</li>\n" +
+			"<li><del>\n<p>two</p>\n</del></li>\n" +
+			"<li><ins>\n<p>TWO</p>\n</ins></li>\n" +
+			"</ul>\n" +
+			"<ol>\n" +
+			"<li>a</li>\n" +
+			"<li>b</li>\n" +
+			"<li><ins>c</ins></li>\n" +
+			"</ol>\n",
+		))
+	})
+
+	It("should be the same as the HTML when nothing changed", func() {
+		source, err := os.ReadFile("../documents/terms-of-use.md")
+		Expect(err).ToNot(HaveOccurred())
+
+		html, err := HTML(string(source))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(DiffHTML(string(source), string(source))).To(Equal(html))
+	})
+
+	It("should sanitise both versions", func() {
+		html, err := DiffHTML("[a](https://example.com)", "[a](javascript:alert(1))")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(html).ToNot(ContainSubstring("javascript:"))
+	})
+})
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/alphagov/paas-accounts/database"
+)
+
+// migrateCommand runs `paas-accounts migrate`, so that schema changes can be
+// applied as a step of their own before the new code is deployed.
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("a migrate command is required\n%s", usage)
+	}
+
+	var run func(db *database.DB) error
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return fmt.Errorf("migrate status takes no arguments\n%s", usage)
+		}
+		run = migrateStatus
+	case "up":
+		if len(args) != 1 {
+			return fmt.Errorf("migrate up takes no arguments\n%s", usage)
+		}
+		run = func(db *database.DB) error {
+			return db.MigrateUp()
+		}
+	case "down":
+		n, err := migrateArg(args, "N")
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("migrate down N needs N to be at least 1")
+		}
+		run = func(db *database.DB) error {
+			return db.MigrateDown(int(n))
+		}
+	case "goto":
+		version, err := migrateArg(args, "VERSION")
+		if err != nil {
+			return err
+		}
+		run = func(db *database.DB) error {
+			return db.MigrateTo(version)
+		}
+	case "force":
+		version, err := migrateArg(args, "VERSION")
+		if err != nil {
+			return err
+		}
+		run = func(db *database.DB) error {
+			return db.ForceMigrationVersion(version)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := run(db); err != nil {
+		return err
+	}
+	if args[0] == "status" {
+		return nil
+	}
+	return migrateStatus(db)
+}
+
+func migrateArg(args []string, name string) (uint, error) {
+	if len(args) != 2 {
+		return 0, fmt.Errorf("migrate %s takes %s\n%s", args[0], name, usage)
+	}
+	n, err := strconv.ParseUint(args[1], 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be a whole number", name, args[1])
+	}
+	return uint(n), nil
+}
+
+// migrateStatus prints the version of the database and which migrations have
+// been applied.
+func migrateStatus(db *database.DB) error {
+	migrations, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+	version, dirty, err := db.MigrationVersion(globalContext)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d\n", version)
+	if dirty {
+		fmt.Printf("migration %d failed part way through: fix the database, then run migrate force VERSION\n", version)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, migration := range migrations {
+		state := "pending"
+		if migration.Version < version || (migration.Version == version && !dirty) {
+			state = "applied"
+		} else if migration.Version == version {
+			state = "dirty"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, state)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alphagov/paas-accounts/api"
+	"github.com/alphagov/paas-accounts/database"
+)
+
+// serve runs the server, first migrating the database unless --no-migrate
+// is given, for when migrations are applied as a separate step.
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	noMigrate := flags.Bool("no-migrate", false, "do not migrate the database before serving")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s\n%s", strings.Join(flags.Args(), " "), usage)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *noMigrate {
+		warnIfNotMigrated(db)
+	} else if err := db.Init(); err != nil {
+		return err
+	}
+
+	var clients []api.Client
+	if data := os.Getenv("API_CLIENTS"); data != "" {
+		clients, err = api.ParseClients([]byte(data))
+		if err != nil {
+			return err
+		}
+	}
+
+	var tokenVerifier *api.TokenVerifier
+	if keysFile := os.Getenv("TOKEN_KEYS_FILE"); keysFile != "" {
+		keyData, err := os.ReadFile(keysFile)
+		if err != nil {
+			return err
+		}
+		scopePrefix, ok := os.LookupEnv("TOKEN_SCOPE_PREFIX")
+		if !ok {
+			scopePrefix = "paas-accounts."
+		}
+		tokenVerifier, err = api.NewTokenVerifier(keyData, os.Getenv("TOKEN_AUDIENCE"), os.Getenv("TOKEN_ISSUER"), scopePrefix)
+		if err != nil {
+			return fmt.Errorf("invalid token settings: %s", err)
+		}
+	}
+
+	var trustedProxies []*net.IPNet
+	if s := os.Getenv("TRUSTED_PROXIES"); s != "" {
+		trustedProxies, err = api.ParseTrustedProxies(s)
+		if err != nil {
+			return fmt.Errorf("invalid TRUSTED_PROXIES: %s", err)
+		}
+	}
+
+	var drainDelay time.Duration
+	if s := os.Getenv("DRAIN_DELAY"); s != "" {
+		drainDelay, err = time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid DRAIN_DELAY: %s", err)
+		}
+	}
+
+	config := api.Config{
+		DB:                        db,
+		BasicAuthUsername:         os.Getenv("BASIC_AUTH_USERNAME"),
+		BasicAuthPassword:         os.Getenv("BASIC_AUTH_PASSWORD"),
+		BasicAuthPreviousPassword: os.Getenv("BASIC_AUTH_PREVIOUS_PASSWORD"),
+		Clients:                   clients,
+		TokenVerifier:             tokenVerifier,
+		TrustedProxies:            trustedProxies,
+		DrainDelay:                drainDelay,
+	}
+	if err := config.Check(); err != nil {
+		return err
+	}
+
+	server := api.NewServer(config)
+	addr := fmt.Sprintf("0.0.0.0:%s", os.Getenv("PORT"))
+	fmt.Println("server started at", addr)
+	return api.ListenAndServe(globalContext, server, addr)
+}
+
+// warnIfNotMigrated logs when the database is behind this build. It does
+// not stop the server starting, since GET /readyz reports it as not ready
+// until the migrations are applied.
+func warnIfNotMigrated(db *database.DB) {
+	latest, err := database.LatestMigrationVersion()
+	if err != nil {
+		log.Printf("cannot read the migrations: %s", err)
+		return
+	}
+	version, dirty, err := db.MigrationVersion(globalContext)
+	if err != nil {
+		log.Printf("cannot read the migration version: %s", err)
+		return
+	}
+	if dirty {
+		log.Printf("migration %d failed part way through, see paas-accounts migrate status", version)
+	} else if version < latest {
+		log.Printf("the database is at migration %d but this build needs %d, run paas-accounts migrate up", version, latest)
+	}
+}
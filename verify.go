@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+)
+
+// verifyCommand runs `paas-accounts verify`, which checks the hash chain
+// linking documents and agreements has not been broken. The head it prints
+// should be recorded somewhere outside the database, as rows removed from the
+// end of the chain can only be noticed by comparing it with a later run.
+func verifyCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("verify takes no arguments\n%s", usage)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := db.VerifyChain(globalContext)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("rows: %d\n", report.Rows)
+	fmt.Printf("head: %s\n", report.Head)
+	for _, problem := range report.Problems {
+		fmt.Printf("seq %d, %s: %s\n", problem.Seq, problem.Row, problem.Problem)
+	}
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("the hash chain has %d problems", len(report.Problems))
+	}
+	return nil
+}